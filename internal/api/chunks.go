@@ -0,0 +1,329 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/internal/vad"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+// Prefix of the checkpoint files in tmpDir, they are removed by the sweeper
+// like the uploads once no running transcription uses them
+const checkpointPrefix = "checkpoint-"
+
+// chunk is a window of the audio transcribed on its own
+type chunk struct {
+	start, end time.Duration
+}
+
+// chunked reports whether the audio is transcribed in chunks. Only files are,
+// the chunks are windows of the decoded file.
+func (whisperState *WhisperState) chunked(opts TranscribeOptions, source audioSource) bool {
+	return whisperState.chunkLength > 0 && source.path != "" && whisperState.vadMode(opts) == vad.ModeOff
+}
+
+// splitChunks splits the audio into chunks of length which overlap the next
+// chunk by overlap
+func splitChunks(duration time.Duration, length time.Duration, overlap time.Duration) []chunk {
+	var chunks []chunk
+	for start := time.Duration(0); ; start += length - overlap {
+		end := min(start+length, duration)
+		chunks = append(chunks, chunk{start: start, end: end})
+		if end == duration {
+			return chunks
+		}
+	}
+}
+
+// transcribeChunked transcribes the audio file in overlapping chunks, on as
+// many workers in parallel as are free, and stitches the chunks together in
+// the middle of each overlap. Every completed chunk is saved to a checkpoint,
+// so transcribing the same file again after a failure resumes. Files no
+// longer than a chunk are transcribed in a single run.
+func (whisperState *WhisperState) transcribeChunked(logger *slog.Logger, opts TranscribeOptions, settings decoding, audioPath string) (*transcript.Transcript, time.Duration, error) {
+	ticks, err := whisperState.fileDuration(audioPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := checkDuration(ticks, whisperState.maxAudioDuration); err != nil {
+		return nil, 0, err
+	}
+	if ticksDuration(ticks) <= whisperState.chunkLength {
+		return whisperState.transcribeWhole(logger, opts, settings, audioSource{path: audioPath})
+	}
+
+	buffer, err := whisperState.media.LoadAudioFile(audioPath, true)
+	if err != nil {
+		return nil, 0, fmt.Errorf("loading audio file: %w", err)
+	}
+	defer buffer.Release()
+
+	samples, err := buffer.CountSamples()
+	if err != nil {
+		return nil, 0, fmt.Errorf("counting audio samples: %w", err)
+	}
+	duration := samplesDuration(samples)
+	chunks := splitChunks(duration, whisperState.chunkLength, whisperState.chunkOverlap)
+
+	checkpoint, err := whisperState.openCheckpoint(audioPath, settings)
+	if err != nil {
+		return nil, 0, fmt.Errorf("opening checkpoint: %w", err)
+	}
+	whisperState.jobs.holdCheckpoint(checkpoint.path)
+	defer whisperState.jobs.releaseCheckpoint(checkpoint.path)
+
+	results := make([][]transcript.Segment, len(chunks))
+	var pending []int
+	for i := range chunks {
+		if segments, ok := checkpoint.Chunks[i]; ok {
+			results[i] = segments
+		} else {
+			pending = append(pending, i)
+		}
+	}
+	logger.Debug("Transcribing in chunks", "chunks", len(chunks), "resumed", len(chunks)-len(pending))
+
+	var failed atomic.Bool
+	var errMutex sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	indexes := make(chan int)
+
+	for i := 0; i < min(whisperState.Workers(), len(pending)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				if failed.Load() {
+					continue
+				}
+
+				segments, err := whisperState.transcribeChunk(logger, settings, buffer, chunks[index], duration)
+				if err != nil {
+					errMutex.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					errMutex.Unlock()
+					failed.Store(true)
+					continue
+				}
+
+				results[index] = segments
+				if err := checkpoint.save(index, segments); err != nil {
+					logger.Warn("Error saving checkpoint", "error", err)
+				}
+			}
+		}()
+	}
+
+	for _, i := range pending {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, 0, firstErr
+	}
+	checkpoint.remove()
+
+	return &transcript.Transcript{Segments: stitchChunks(chunks, results, duration)}, duration, nil
+}
+
+// stitchChunks joins the segments of the chunks, cutting every overlap in its
+// middle, and numbers them
+func stitchChunks(chunks []chunk, results [][]transcript.Segment, duration time.Duration) []transcript.Segment {
+	var segments []transcript.Segment
+	for i := range chunks {
+		from, to := time.Duration(0), duration
+		if i > 0 {
+			from = (chunks[i-1].end + chunks[i].start) / 2
+		}
+		if i < len(chunks)-1 {
+			to = (chunks[i].end + chunks[i+1].start) / 2
+		}
+		segments = append(segments, clipSegments(results[i], from, to)...)
+	}
+	for i := range segments {
+		segments[i].ID = i
+	}
+	return segments
+}
+
+// transcribeChunk transcribes a chunk of the decoded audio on a free worker
+func (whisperState *WhisperState) transcribeChunk(logger *slog.Logger, settings decoding, buffer *whisper.AudioBuffer, c chunk, duration time.Duration) ([]transcript.Segment, error) {
+	w := whisperState.acquire()
+	defer whisperState.release(w)
+
+	if err := whisperState.prepare(w, settings); err != nil {
+		return nil, err
+	}
+
+	// The chunks are decoded in any order, the text the context decoded
+	// before is not the text preceding the chunk. The token timestamps place
+	// the words in the overlaps.
+	if !w.params.HasFlags(whisper.FlagNoContext) {
+		w.params.AddFlags(whisper.FlagNoContext)
+		defer w.params.RemoveFlags(whisper.FlagNoContext)
+	}
+	if !w.params.HasFlags(whisper.FlagTokenTimestamps) {
+		w.params.AddFlags(whisper.FlagTokenTimestamps)
+		defer w.params.RemoveFlags(whisper.FlagTokenTimestamps)
+	}
+
+	w.params.SetWindow(int32(c.start.Milliseconds()), int32((c.end - c.start).Milliseconds()))
+	defer w.params.SetWindow(0, 0)
+
+	err := whisperState.runResult(w, w.context.RunFull(w.params, buffer))
+	if whisperState.jobs.cancelled.Load() {
+		return nil, errCancelled
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := getResult(w.context)
+	if err != nil {
+		return nil, err
+	}
+	result.Segments = windowSegments(result.Segments)
+
+	if whisperState.fallbackOptions.Enabled {
+		if err := whisperState.fallback(logger, w, result, duration, audioSource{buffer: buffer}); err != nil {
+			return nil, err
+		}
+	}
+
+	return result.Segments, nil
+}
+
+// clipSegments returns the part of the segments between from and to. Segments
+// crossing a bound keep the tokens starting within the bounds, so a word
+// transcribed by two overlapping chunks is kept once.
+func clipSegments(segments []transcript.Segment, from time.Duration, to time.Duration) []transcript.Segment {
+	var result []transcript.Segment
+	for _, seg := range segments {
+		if seg.Start >= from && seg.End <= to {
+			result = append(result, seg)
+			continue
+		}
+		if seg.End <= from || seg.Start >= to {
+			continue
+		}
+
+		tokens := seg.TextTokens()
+		if len(tokens) == 0 {
+			if middle := (seg.Start + seg.End) / 2; middle >= from && middle < to {
+				result = append(result, seg)
+			}
+			continue
+		}
+
+		var kept []transcript.Token
+		var text strings.Builder
+		for _, token := range tokens {
+			if token.Start >= from && token.Start < to {
+				kept = append(kept, token)
+				text.WriteString(token.Text)
+			}
+		}
+		if len(kept) == 0 {
+			continue
+		}
+
+		seg.Tokens = kept
+		seg.Text = text.String()
+		seg.Start = max(kept[0].Start, from)
+		seg.End = min(max(kept[len(kept)-1].End, seg.Start), to)
+		result = append(result, seg)
+	}
+	return result
+}
+
+// checkpoint holds the chunks of a file transcribed so far
+type checkpoint struct {
+	path  string
+	mutex sync.Mutex
+
+	Chunks map[int][]transcript.Segment `json:"chunks"`
+}
+
+// openCheckpoint loads the checkpoint of the audio file, which is identified by
+// its content and the settings the chunks depend on
+func (whisperState *WhisperState) openCheckpoint(audioPath string, settings decoding) (*checkpoint, error) {
+	file, err := os.Open(audioPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(hash, "\x00%d\x00%d\x00%d\x00%t\x00%s", whisperState.chunkLength, whisperState.chunkOverlap,
+		settings.language, whisperState.fallbackOptions.Enabled, settings.prompt)
+
+	tmpDir, err := ensureDir(whisperState.tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &checkpoint{
+		path:   filepath.Join(tmpDir, checkpointPrefix+hex.EncodeToString(hash.Sum(nil))[:32]+".json"),
+		Chunks: make(map[int][]transcript.Segment),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		slog.Warn("Ignoring unreadable checkpoint", "path", c.path, "error", err)
+		c.Chunks = make(map[int][]transcript.Segment)
+	}
+	return c, nil
+}
+
+// save records a completed chunk. The file is replaced atomically, so an
+// interrupted write leaves the previous checkpoint.
+func (c *checkpoint) save(index int, segments []transcript.Segment) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.Chunks[index] = segments
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// remove deletes the checkpoint of a completed transcription
+func (c *checkpoint) remove() {
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("Error removing checkpoint", "path", c.path, "error", err)
+	}
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+)
+
+func TestSplitChunks(t *testing.T) {
+	s := time.Second
+	tests := []struct {
+		duration, length, overlap time.Duration
+		want                      []chunk
+	}{
+		// Shorter than a chunk
+		{20 * s, 30 * s, 10 * s, []chunk{{0, 20 * s}}},
+		{30 * s, 30 * s, 10 * s, []chunk{{0, 30 * s}}},
+		// The chunks end exactly at the end of the audio
+		{50 * s, 30 * s, 10 * s, []chunk{{0, 30 * s}, {20 * s, 50 * s}}},
+		// The last chunk is short
+		{65 * s, 30 * s, 10 * s, []chunk{{0, 30 * s}, {20 * s, 50 * s}, {40 * s, 65 * s}}},
+		// The last chunk barely extends past the previous one
+		{31 * s, 30 * s, 10 * s, []chunk{{0, 30 * s}, {20 * s, 31 * s}}},
+		// No overlap
+		{60 * s, 30 * s, 0, []chunk{{0, 30 * s}, {30 * s, 60 * s}}},
+		{0, 30 * s, 10 * s, []chunk{{0, 0}}},
+	}
+	for _, tt := range tests {
+		got := splitChunks(tt.duration, tt.length, tt.overlap)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("splitChunks(%s, %s, %s) = %v, want %v", tt.duration, tt.length, tt.overlap, got, tt.want)
+		}
+
+		// Every chunk overlaps the next one and the last one ends the audio
+		for i := 1; i < len(got); i++ {
+			if got[i].start != got[i-1].end-tt.overlap {
+				t.Errorf("splitChunks(%s, %s, %s): chunk %d starts at %s, want %s", tt.duration, tt.length, tt.overlap, i, got[i].start, got[i-1].end-tt.overlap)
+			}
+		}
+		if end := got[len(got)-1].end; end != tt.duration {
+			t.Errorf("splitChunks(%s, %s, %s) ends at %s", tt.duration, tt.length, tt.overlap, end)
+		}
+	}
+}
+
+// word returns a text token of the word from start to end, in seconds
+func word(text string, start, end float64) transcript.Token {
+	return transcript.Token{Text: text, Start: seconds(start), End: seconds(end)}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+func TestClipSegments(t *testing.T) {
+	from, to := seconds(25), seconds(55)
+	tests := []struct {
+		name string
+		seg  transcript.Segment
+		want []transcript.Segment
+	}{
+		{
+			name: "inside",
+			seg:  transcript.Segment{Start: seconds(30), End: seconds(40), Text: " inside"},
+			want: []transcript.Segment{{Start: seconds(30), End: seconds(40), Text: " inside"}},
+		},
+		{
+			name: "before",
+			seg:  transcript.Segment{Start: seconds(20), End: seconds(25), Text: " before"},
+		},
+		{
+			name: "after",
+			seg:  transcript.Segment{Start: seconds(55), End: seconds(60), Text: " after"},
+		},
+		{
+			name: "crossing the start",
+			seg: transcript.Segment{Start: seconds(22), End: seconds(28), Text: " one two three", Tokens: []transcript.Token{
+				{Text: "[_BEG_]", Special: true}, word(" one", 22, 24), word(" two", 24.5, 25.5), word(" three", 26, 28),
+			}},
+			want: []transcript.Segment{{Start: seconds(26), End: seconds(28), Text: " three", Tokens: []transcript.Token{word(" three", 26, 28)}}},
+		},
+		{
+			name: "crossing the end",
+			seg: transcript.Segment{Start: seconds(52), End: seconds(58), Text: " one two three", Tokens: []transcript.Token{
+				word(" one", 52, 54), word(" two", 54.5, 55.5), word(" three", 56, 58),
+			}},
+			want: []transcript.Segment{{Start: seconds(52), End: seconds(55), Text: " one two", Tokens: []transcript.Token{word(" one", 52, 54), word(" two", 54.5, 55.5)}}},
+		},
+		{
+			name: "crossing the start without kept tokens",
+			seg: transcript.Segment{Start: seconds(22), End: seconds(26), Text: " one", Tokens: []transcript.Token{
+				word(" one", 22, 24.9),
+			}},
+		},
+		{
+			name: "crossing the start without tokens, middle inside",
+			seg:  transcript.Segment{Start: seconds(24), End: seconds(28), Text: " kept"},
+			want: []transcript.Segment{{Start: seconds(24), End: seconds(28), Text: " kept"}},
+		},
+		{
+			name: "crossing the end without tokens, middle outside",
+			seg:  transcript.Segment{Start: seconds(54), End: seconds(58), Text: " dropped"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := clipSegments([]transcript.Segment{tt.seg}, from, to)
+		if !equalSegments(got, tt.want) {
+			t.Errorf("%s: clipSegments = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func equalSegments(a, b []transcript.Segment) bool {
+	return slices.EqualFunc(a, b, func(x, y transcript.Segment) bool {
+		return x.ID == y.ID && x.Start == y.Start && x.End == y.End && x.Text == y.Text && slices.Equal(x.Tokens, y.Tokens)
+	})
+}
+
+// TestStitchChunks transcribes a segment crossing the middle of the overlap in
+// both chunks and expects every word once, from the chunk it starts in
+func TestStitchChunks(t *testing.T) {
+	chunks := splitChunks(seconds(50), seconds(30), seconds(10))
+	results := [][]transcript.Segment{
+		{
+			{Start: 0, End: seconds(10), Text: " first"},
+			{Start: seconds(22), End: seconds(30), Text: " before middle after", Tokens: []transcript.Token{
+				word(" before", 22, 24), word(" middle", 24.5, 26), word(" after", 27, 30),
+			}},
+		},
+		{
+			{Start: seconds(20), End: seconds(28), Text: " before middle after", Tokens: []transcript.Token{
+				word(" before", 22, 24), word(" middle", 24.6, 26), word(" after", 27, 28),
+			}},
+			{Start: seconds(40), End: seconds(50), Text: " last"},
+		},
+	}
+
+	want := []transcript.Segment{
+		{ID: 0, Start: 0, End: seconds(10), Text: " first"},
+		{ID: 1, Start: seconds(22), End: seconds(25), Text: " before middle", Tokens: []transcript.Token{word(" before", 22, 24), word(" middle", 24.5, 26)}},
+		{ID: 2, Start: seconds(27), End: seconds(28), Text: " after", Tokens: []transcript.Token{word(" after", 27, 28)}},
+		{ID: 3, Start: seconds(40), End: seconds(50), Text: " last"},
+	}
+	if got := stitchChunks(chunks, results, seconds(50)); !equalSegments(got, want) {
+		t.Errorf("stitchChunks = %+v\nwant %+v", got, want)
+	}
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xzeldon/whisper-api-server/internal/openapi"
+)
+
+// OpenAPI serves the OpenAPI specification
+func OpenAPI(c echo.Context) error {
+	return c.Blob(http.StatusOK, echo.MIMEApplicationJSONCharsetUTF8, openapi.Spec())
+}
+
+// Docs serves a page rendering the specification
+func Docs(c echo.Context) error {
+	return c.HTMLBlob(http.StatusOK, openapi.DocsPage())
+}
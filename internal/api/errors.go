@@ -0,0 +1,36 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xzeldon/whisper-api-server/internal/logging"
+)
+
+// ErrorHandler writes the errors returned by handlers in the {"error": message}
+// shape of the API. The details of internal errors are only logged.
+func ErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	code := http.StatusInternalServerError
+	message := "Internal server error"
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		code = httpErr.Code
+		message = fmt.Sprint(httpErr.Message)
+	}
+
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(code)
+	} else {
+		err = c.JSON(code, map[string]string{"error": message})
+	}
+	if err != nil {
+		logging.FromContext(c.Request().Context()).Error("Error writing the error response", "error", err)
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/xzeldon/whisper-api-server/internal/metrics"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+// FallbackOptions configures the second decoding of windows which look like
+// a failed transcription, e.g. the same line repeated over and over.
+//
+// OpenAI's Whisper decodes such windows again at a higher temperature. The
+// Whisper.dll engine has no sampling temperature, so the window is decoded
+// again without the text of the previous windows and without the prompt,
+// which is what feeds the repetition loops.
+type FallbackOptions struct {
+	Enabled bool
+
+	// Segments compressing better than this are repetitive, 2.4 in OpenAI's Whisper
+	CompressionRatioThreshold float64
+
+	// Segments whose tokens have a lower average log probability are unreliable,
+	// -1.0 in OpenAI's Whisper
+	LogprobThreshold float64
+}
+
+// Shortest window decoded again, shorter segments are widened around their centre
+const minFallbackWindow = time.Second
+
+// failed reports whether the segments fail the thresholds
+func (opts FallbackOptions) failed(segments []transcript.Segment) bool {
+	ratio, logprob := quality(segments)
+	return ratio > opts.CompressionRatioThreshold || logprob < opts.LogprobThreshold
+}
+
+// better reports whether the candidate segments are better than the current ones
+func (opts FallbackOptions) better(candidate []transcript.Segment, current []transcript.Segment) bool {
+	if len(candidate) == 0 {
+		return false
+	}
+	if !opts.failed(candidate) {
+		return true
+	}
+
+	candidateRatio, candidateLogprob := quality(candidate)
+	currentRatio, currentLogprob := quality(current)
+	if candidateRatio != currentRatio {
+		return candidateRatio < currentRatio
+	}
+	return candidateLogprob > currentLogprob
+}
+
+// quality returns the compression ratio and the average log probability of
+// the segments taken as one
+func quality(segments []transcript.Segment) (float64, float64) {
+	var joined transcript.Segment
+	var text strings.Builder
+	for _, seg := range segments {
+		text.WriteString(seg.Text)
+		joined.Tokens = append(joined.Tokens, seg.Tokens...)
+	}
+	joined.Text = text.String()
+
+	return joined.CompressionRatio(), joined.AvgLogprob()
+}
+
+// fallbackWindow is a run of consecutive failing segments
+type fallbackWindow struct {
+	first, last int // Indexes of the segments
+	start, end  time.Duration
+}
+
+// failingWindows groups the consecutive segments which fail the thresholds
+func (opts FallbackOptions) failingWindows(segments []transcript.Segment, duration time.Duration) []fallbackWindow {
+	var windows []fallbackWindow
+	for i := range segments {
+		if strings.TrimSpace(segments[i].Text) == "" || !opts.failed(segments[i:i+1]) {
+			continue
+		}
+
+		if n := len(windows); n > 0 && windows[n-1].last == i-1 {
+			windows[n-1].last = i
+			windows[n-1].end = segments[i].End
+			continue
+		}
+		windows = append(windows, fallbackWindow{first: i, last: i, start: segments[i].Start, end: segments[i].End})
+	}
+
+	for i := range windows {
+		if length := windows[i].end - windows[i].start; length < minFallbackWindow {
+			pad := (minFallbackWindow - length) / 2
+			windows[i].start = max(windows[i].start-pad, 0)
+			windows[i].end = windows[i].start + minFallbackWindow
+			if duration > 0 && windows[i].end > duration {
+				windows[i].end = duration
+			}
+		}
+	}
+	return windows
+}
+
+// fallback decodes the failing windows of result again and replaces their
+// segments when the new decoding is better. The params of the worker are
+// restored afterwards.
+func (whisperState *WhisperState) fallback(logger *slog.Logger, w *worker, result *transcript.Transcript, duration time.Duration, source audioSource) error {
+	opts := whisperState.fallbackOptions
+	windows := opts.failingWindows(result.Segments, duration)
+	if len(windows) == 0 {
+		return nil
+	}
+
+	prompt := w.params.Prompt()
+	noContext := w.params.HasFlags(whisper.FlagNoContext)
+
+	w.params.SetPrompt(nil)
+	if !noContext {
+		w.params.AddFlags(whisper.FlagNoContext)
+	}
+	defer func() {
+		w.params.SetWindow(0, 0)
+		w.params.SetPrompt(prompt)
+		if !noContext {
+			w.params.RemoveFlags(whisper.FlagNoContext)
+		}
+	}()
+
+	// Windows are replaced from the last one, so the indexes of the earlier
+	// windows stay valid
+	for i := len(windows) - 1; i >= 0; i-- {
+		window := windows[i]
+		current := result.Segments[window.first : window.last+1]
+
+		logger.Debug("Decoding window again", "start", window.start, "end", window.end)
+		metrics.FallbackDecodings.Inc()
+
+		w.params.SetWindow(int32(window.start.Milliseconds()), int32((window.end - window.start).Milliseconds()))
+		_, err := whisperState.decode(w, source)
+		if whisperState.jobs.cancelled.Load() {
+			return errCancelled
+		}
+		if err != nil {
+			return err
+		}
+
+		decoded, err := getResult(w.context)
+		if err != nil {
+			return err
+		}
+		candidate := windowSegments(decoded.Segments)
+
+		if !opts.better(candidate, current) {
+			logger.Debug("Keeping the first decoding of the window", "start", window.start, "end", window.end)
+			continue
+		}
+
+		fallback := current[0].Fallback + 1
+		for j := range candidate {
+			candidate[j].Fallback = fallback
+		}
+
+		segments := append([]transcript.Segment(nil), result.Segments[:window.first]...)
+		segments = append(segments, candidate...)
+		result.Segments = append(segments, result.Segments[window.last+1:]...)
+	}
+
+	for i := range result.Segments {
+		result.Segments[i].ID = i
+	}
+	return nil
+}
+
+// windowSegments returns the segments with text decoded for a window set by
+// FullParams.SetWindow. Their timestamps need no shift: the engine ports the
+// decoding loop of whisper.cpp, which seeks to the window offset in the audio
+// and reports every timestamp from the start of the audio.
+func windowSegments(segments []transcript.Segment) []transcript.Segment {
+	result := make([]transcript.Segment, 0, len(segments))
+	for _, seg := range segments {
+		if strings.TrimSpace(seg.Text) != "" {
+			result = append(result, seg)
+		}
+	}
+	return result
+}
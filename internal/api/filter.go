@@ -0,0 +1,21 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+)
+
+// resultFilters returns the filters selected by the options, or the default
+// filters of the server
+func (whisperState *WhisperState) resultFilters(opts TranscribeOptions) ([]transcript.Filter, error) {
+	if opts.Filters == nil {
+		return whisperState.filters, nil
+	}
+
+	filters, err := transcript.ParseFilters(opts.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidOption, err)
+	}
+	return filters, nil
+}
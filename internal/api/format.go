@@ -0,0 +1,79 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+)
+
+// Longest duration in seconds which fits a time.Duration
+const maxSeconds = float64(math.MaxInt64 / time.Second)
+
+// parseFinite parses a number, rejecting NaN and infinities
+func parseFinite(value string) (float64, error) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, fmt.Errorf("%q is not a finite number", value)
+	}
+	return f, nil
+}
+
+// writeOptions reads the settings of the formats from the request, fields
+// which are not given keep their defaults. Durations are in seconds.
+func writeOptions(c echo.Context) (transcript.WriteOptions, error) {
+	opts := transcript.DefaultWriteOptions()
+	subtitles := &opts.Subtitles
+
+	ints := map[string]*int{
+		"max_line_length": &subtitles.MaxLineLength,
+		"max_lines":       &subtitles.MaxLines,
+	}
+	for name, field := range ints {
+		if value := c.FormValue(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return opts, fmt.Errorf("invalid %s %q, expected a number", name, value)
+			}
+			*field = n
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"min_duration": &subtitles.MinDuration,
+		"max_duration": &subtitles.MaxDuration,
+	}
+	for name, field := range durations {
+		if value := c.FormValue(name); value != "" {
+			seconds, err := parseFinite(value)
+			if err != nil || math.Abs(seconds) > maxSeconds {
+				return opts, fmt.Errorf("invalid %s %q, expected seconds", name, value)
+			}
+			*field = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if value := c.FormValue("max_cps"); value != "" {
+		cps, err := parseFinite(value)
+		if err != nil {
+			return opts, fmt.Errorf("invalid max_cps %q, expected characters per second", value)
+		}
+		subtitles.MaxCPS = cps
+	}
+
+	if value := c.FormValue("timestamp_interval"); value != "" {
+		seconds, err := parseFinite(value)
+		if err != nil || seconds < 0 || seconds > maxSeconds {
+			return opts, fmt.Errorf("invalid timestamp_interval %q, expected seconds", value)
+		}
+		opts.TimestampInterval = time.Duration(seconds * float64(time.Second))
+	}
+
+	return opts, subtitles.Validate()
+}
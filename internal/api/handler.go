@@ -1,107 +1,261 @@
 package api
 
 import (
-	"io"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
-	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/xzeldon/whisper-api-server/internal/logging"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/internal/vad"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
 )
 
-type TranscribeResponse struct {
-	Text string `json:"text"`
-}
+// errEmptyResult is recorded when the transcription produced no text
+var errEmptyResult = errors.New("transcription produced no text")
 
 func TranscribeFromFile(c echo.Context, whisperState *WhisperState) error {
-	audioPath, err := saveFormFile("file", c)
-	if err != nil {
-		c.Logger().Errorf("Error reading file: %s", err)
+	if !whisperState.jobs.begin() {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Server is shutting down"})
+	}
+	defer whisperState.jobs.end()
+
+	logger := logging.FromContext(c.Request().Context())
+
+	if err := whisperState.parseUpload(c); err != nil {
 		return err
 	}
 
-	whisperState.mutex.Lock()
-	buffer, err := whisperState.media.LoadAudioFile(audioPath, true)
+	format, err := transcript.ParseFormat(c.FormValue("response_format"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	writeOpts, err := writeOptions(c)
 	if err != nil {
-		c.Logger().Errorf("Error loading audio file data: %s", err)
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	err = whisperState.context.RunFull(whisperState.params, buffer)
+	opts := TranscribeOptions{
+		Prompt:     c.FormValue("prompt"),
+		Glossaries: ParseList(c.FormValue("glossary")),
+	}
+	if filters := ParseList(c.FormValue("filters")); len(filters) > 0 {
+		opts.Filters = filters
+	}
+	if value := c.FormValue("language"); value != "" {
+		opts.Language, err = parseLanguage(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	if value := c.FormValue("target_language"); value != "" {
+		opts.TargetLanguage, err = parseLanguage(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	if value := c.FormValue("vad"); value != "" {
+		opts.VAD, err = vad.ParseMode(value)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	mode := whisperState.vadMode(opts)
 
+	// Speech detection reads the decoded samples, which needs the file on disk
+	source, cleanup, err := whisperState.receiveAudio(c, logger, mode == vad.ModeOff)
 	if err != nil {
-		c.Logger().Errorf("Error processing audio: %s", err)
 		return err
 	}
+	defer cleanup()
 
-	result, err := getResult(whisperState.context)
-	if err != nil {
-		c.Logger().Error(err)
+	if mode == vad.ModeRegions {
+		return whisperState.speechRegions(c, logger, source.path)
 	}
 
-	defer whisperState.mutex.Unlock()
+	result, err := whisperState.transcribe(c.Request().Context(), logger, opts, source)
 
-	if len(result) == 0 {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	if errors.Is(err, errInvalidOption) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
-	response := TranscribeResponse{
-		Text: strings.TrimLeft(result, " "),
+	if errors.Is(err, errCancelled) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
 	}
 
-	return c.JSON(http.StatusOK, response)
-}
+	if errors.Is(err, errTranslation) {
+		logger.Error("Error translating the transcript", "error", err)
+		whisperState.lastError.set(err)
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+
+	if errors.Is(err, errAudioTooLong) {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+	}
 
-func Transcribe(c echo.Context, whisperState *WhisperState) error {
-	// Get the file header
-	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		c.Logger().Errorf("Error retrieving the file: %s", err)
+		logger.Error("Error processing audio", "error", err)
+		whisperState.lastError.set(err)
 		return err
 	}
 
-	// Open the file
-	file, err := fileHeader.Open()
+	// The filters and the speech detection may remove every segment, e.g. of silent audio
+	if filters, _ := whisperState.resultFilters(opts); result.Text() == "" && len(filters) == 0 && mode == vad.ModeOff {
+		whisperState.lastError.set(errEmptyResult)
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	}
+
+	c.Response().Header().Set(echo.HeaderContentType, format.ContentType())
+	c.Response().WriteHeader(http.StatusOK)
+	return transcript.Write(c.Response(), format, result, writeOpts)
+}
+
+// receiveAudio reads the uploaded audio file of the request. Small uploads are
+// kept in memory when inMemory is set, others are saved to a temp file which
+// cleanup removes. The form was parsed by parseUpload. Client errors are
+// returned as echo.HTTPError.
+func (whisperState *WhisperState) receiveAudio(c echo.Context, logger *slog.Logger, inMemory bool) (audioSource, func(), error) {
+	var source audioSource
+	cleanup := func() {}
+
+	fileHeader, err := c.FormFile("file")
 	if err != nil {
-		c.Logger().Errorf("Error opening the file: %s", err)
-		return err
+		if errors.Is(err, http.ErrMissingFile) {
+			return source, cleanup, echo.NewHTTPError(http.StatusBadRequest, "file is required")
+		}
+		logger.Error("Error retrieving the file", "error", err)
+		return source, cleanup, err
+	}
+
+	if limit := whisperState.maxUploadSize; limit > 0 && fileHeader.Size > limit {
+		return source, cleanup, uploadTooLarge(limit)
+	}
+
+	if err := sniffFormFile(fileHeader); err != nil {
+		if errors.Is(err, errUnsupportedMedia) {
+			return source, cleanup, echo.NewHTTPError(http.StatusUnsupportedMediaType, err.Error())
+		}
+		logger.Error("Error reading file", "error", err)
+		whisperState.lastError.set(err)
+		return source, cleanup, err
 	}
-	defer file.Close()
 
-	// Read the file into a buffer
-	buffer, err := io.ReadAll(file)
+	if inMemory && fileHeader.Size <= whisperState.memoryDecodeLimit {
+		source.data, err = readFormFile(fileHeader)
+	} else {
+		source.path, err = saveFormFile(fileHeader, whisperState.tmpDir)
+	}
 	if err != nil {
-		c.Logger().Errorf("Error reading the file into buffer: %s", err)
-		return err
+		logger.Error("Error reading file", "error", err)
+		whisperState.lastError.set(err)
+		return source, cleanup, err
+	}
+
+	if source.path != "" {
+		whisperState.jobs.trackTempFile(source.path)
+		cleanup = func() { whisperState.jobs.removeTempFile(source.path) }
 	}
+	return source, cleanup, nil
+}
 
-	whisperState.mutex.Lock()
-	defer whisperState.mutex.Unlock()
+// audioSource is the audio of a transcription, a file on disk, an upload
+// decoded from memory or audio decoded already
+type audioSource struct {
+	path   string
+	data   []byte
+	buffer *whisper.AudioBuffer
+}
 
-	bufferSpecial, err := whisperState.media.LoadAudioFileData(&buffer, true)
+// decode transcribes the audio with the params of the worker. It returns the
+// duration of the audio. The caller holds the worker.
+func (whisperState *WhisperState) decode(w *worker, source audioSource) (time.Duration, error) {
+	if source.buffer != nil {
+		samples, err := source.buffer.CountSamples()
+		if err != nil {
+			return 0, fmt.Errorf("counting audio samples: %w", err)
+		}
+		return samplesDuration(samples), whisperState.runResult(w, w.context.RunFull(w.params, source.buffer))
+	}
+	if source.path != "" {
+		return whisperState.runFull(w, source.path)
+	}
+	return whisperState.runStreamed(w, source.data)
+}
 
+// fileDuration reads the duration of an audio file without decoding it, in
+// 100-nanoseconds ticks
+func (whisperState *WhisperState) fileDuration(audioPath string) (uint64, error) {
+	reader, err := whisperState.media.OpenAudioFile(audioPath, true)
 	if err != nil {
-		c.Logger().Errorf("Error loading audio file data: %s", err)
-		return err
+		return 0, fmt.Errorf("opening audio file: %w", err)
 	}
+	defer reader.Release()
 
-	err = whisperState.context.RunStreamed(whisperState.params, bufferSpecial)
+	ticks, err := reader.GetDuration()
 	if err != nil {
-		c.Logger().Errorf("Error processing audio: %s", err)
-		return err
+		return 0, fmt.Errorf("reading audio duration: %w", err)
+	}
+	return ticks, nil
+}
+
+// checkFileDuration rejects an audio file longer than maxAudioDuration
+func (whisperState *WhisperState) checkFileDuration(audioPath string) error {
+	if whisperState.maxAudioDuration <= 0 {
+		return nil
 	}
 
-	result, err := getResult(whisperState.context)
+	ticks, err := whisperState.fileDuration(audioPath)
 	if err != nil {
-		c.Logger().Error(err)
 		return err
 	}
+	return checkDuration(ticks, whisperState.maxAudioDuration)
+}
+
+// runFull decodes the audio file and transcribes it. It returns the duration
+// of the audio. The caller holds the worker.
+func (whisperState *WhisperState) runFull(w *worker, audioPath string) (time.Duration, error) {
+	if err := whisperState.checkFileDuration(audioPath); err != nil {
+		return 0, err
+	}
 
-	if len(result) == 0 {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Internal server error"})
+	buffer, err := whisperState.media.LoadAudioFile(audioPath, true)
+	if err != nil {
+		return 0, fmt.Errorf("loading audio file: %w", err)
+	}
+	defer buffer.Release()
+
+	var duration time.Duration
+	if samples, err := buffer.CountSamples(); err == nil {
+		duration = samplesDuration(samples)
+	}
+
+	return duration, whisperState.runResult(w, w.context.RunFull(w.params, buffer))
+}
+
+// runStreamed decodes the audio from memory and transcribes it. It returns the
+// duration of the audio. The caller holds the worker.
+func (whisperState *WhisperState) runStreamed(w *worker, data []byte) (time.Duration, error) {
+	if len(data) == 0 {
+		return 0, fmt.Errorf("empty audio file")
+	}
+
+	reader, err := whisperState.media.LoadAudioFileData(&data, true)
+	if err != nil {
+		return 0, fmt.Errorf("loading audio file data: %w", err)
 	}
+	defer reader.Release()
 
-	response := TranscribeResponse{
-		Text: strings.TrimLeft(result, " "),
+	ticks, err := reader.GetDuration()
+	if err != nil {
+		return 0, fmt.Errorf("reading audio duration: %w", err)
+	}
+	if err := checkDuration(ticks, whisperState.maxAudioDuration); err != nil {
+		return 0, err
 	}
 
-	return c.JSON(http.StatusOK, response)
+	return ticksDuration(ticks), whisperState.runResult(w, w.context.RunStreamed(w.params, reader))
 }
@@ -0,0 +1,331 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xzeldon/whisper-api-server/internal/logging"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+// errNoSpeech is returned when the detection decodes no text in any language
+var errNoSpeech = errors.New("no speech to detect the language from")
+
+const (
+	// Audio decoded to detect the language, the first window of the model
+	detectWindow = 30 * time.Second
+
+	// Tokens decoded per candidate, enough to compare the languages
+	detectTokens = 16
+
+	// Every candidate costs a decoding, a request compares at most this many
+	maxDetectCandidates = 16
+
+	// Number of scores returned by default
+	defaultDetectTop = 5
+)
+
+// LanguageProbability is the relative score of a candidate language. The
+// scores of the candidates sum to 1, they are not the language probabilities
+// of the model.
+type LanguageProbability struct {
+	Language    string  `json:"language"`
+	Probability float64 `json:"probability"`
+
+	language int32
+}
+
+// LanguageInfo describes a language of the registry
+type LanguageInfo struct {
+	Code       string `json:"code"`
+	Name       string `json:"name"`
+	NativeName string `json:"native_name"`
+}
+
+// LanguagesResponse is the body of the language list
+type LanguagesResponse struct {
+	// Language of the requests without one, auto when it is detected
+	Default   string         `json:"default"`
+	Languages []LanguageInfo `json:"languages"`
+}
+
+// DetectLanguageResponse is the body of the language detection
+type DetectLanguageResponse struct {
+	Language      string                `json:"language"`
+	Probabilities []LanguageProbability `json:"probabilities"`
+
+	// Languages compared by the detection, the result is always one of them
+	Candidates []string `json:"candidates"`
+}
+
+// parseLanguage converts the language of a request, a code or a name, to a
+// language value. auto detects the language.
+func parseLanguage(name string) (int32, error) {
+	language, err := whisper.ParseLanguage(name)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errInvalidOption, err)
+	}
+	return language, nil
+}
+
+// requestLanguage returns the language a request is transcribed in, auto when
+// it is detected. English-only models reject any other language.
+func (whisperState *WhisperState) requestLanguage(opts TranscribeOptions) (int32, error) {
+	language := opts.Language
+	if language == 0 {
+		language = whisperState.language
+	}
+
+	if !whisperState.info.multilingual && language != whisper.English {
+		if language == int32(whisper.Auto) {
+			return 0, fmt.Errorf("%w: the model only transcribes English and cannot detect the language", errInvalidOption)
+		}
+		return 0, fmt.Errorf("%w: the model only transcribes English", errInvalidOption)
+	}
+	return language, nil
+}
+
+// detectLanguage scores the candidate languages from the first 30 seconds of
+// the audio, the best first. Languages which are not candidates are never
+// detected.
+//
+// Whisper.dll does not expose the language token probabilities of the model,
+// so the window is decoded in each candidate language and the languages are
+// compared by the average log probability of the decoded tokens. Audio in
+// another language decodes to unlikely tokens or to a translation, which
+// scores lower.
+func (whisperState *WhisperState) detectLanguage(logger *slog.Logger, source audioSource, candidates []int32) ([]LanguageProbability, error) {
+	w := whisperState.acquire()
+	defer whisperState.release(w)
+
+	// The file is decoded once for every candidate
+	if source.path != "" && source.buffer == nil {
+		buffer, err := whisperState.media.LoadAudioFile(source.path, true)
+		if err != nil {
+			return nil, fmt.Errorf("loading audio file: %w", err)
+		}
+		defer buffer.Release()
+		source = audioSource{buffer: buffer}
+	}
+
+	prompt := w.params.Prompt()
+	noContext := w.params.HasFlags(whisper.FlagNoContext)
+	singleSegment := w.params.HasFlags(whisper.FlagSingleSegment)
+
+	w.params.SetPrompt(nil)
+	if !noContext {
+		w.params.AddFlags(whisper.FlagNoContext)
+	}
+	if !singleSegment {
+		w.params.AddFlags(whisper.FlagSingleSegment)
+	}
+	w.params.SetMaxTokens(detectTokens)
+	w.params.SetWindow(0, int32(detectWindow.Milliseconds()))
+	defer func() {
+		w.params.SetWindow(0, 0)
+		w.params.SetMaxTokens(0)
+		w.params.SetPrompt(prompt)
+		if !noContext {
+			w.params.RemoveFlags(whisper.FlagNoContext)
+		}
+		if !singleSegment {
+			w.params.RemoveFlags(whisper.FlagSingleSegment)
+		}
+		w.params.SetLanguage(whisperState.language)
+	}()
+
+	logprobs := make([]float64, len(candidates))
+	var tokens int
+	for i, language := range candidates {
+		w.params.SetLanguage(language)
+		_, err := whisperState.decode(w, source)
+		if whisperState.jobs.cancelled.Load() {
+			return nil, errCancelled
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := getResult(w.context)
+		if err != nil {
+			return nil, err
+		}
+
+		var joined transcript.Segment
+		for _, seg := range result.Segments {
+			joined.Tokens = append(joined.Tokens, seg.TextTokens()...)
+		}
+		n := len(joined.Tokens)
+		logprobs[i] = math.Inf(-1)
+		if n > 0 {
+			logprobs[i] = joined.AvgLogprob()
+			if i == 0 || logprobs[i] > slices.Max(logprobs[:i]) {
+				tokens = n
+			}
+		}
+		logger.Debug("Decoded language candidate", "language", whisper.LanguageCode(language), "avg_logprob", logprobs[i], "tokens", n)
+	}
+
+	if tokens == 0 {
+		return nil, errNoSpeech
+	}
+
+	// The average is scaled by the length of the best decoding, so the result
+	// approximates the probability of the whole text in each language
+	best := slices.Max(logprobs)
+	var sum float64
+	probabilities := make([]LanguageProbability, len(candidates))
+	for i, language := range candidates {
+		p := math.Exp((logprobs[i] - best) * float64(tokens))
+		sum += p
+		probabilities[i] = LanguageProbability{Language: whisper.LanguageCode(language), Probability: p, language: language}
+	}
+	for i := range probabilities {
+		probabilities[i].Probability /= sum
+	}
+
+	slices.SortStableFunc(probabilities, func(a, b LanguageProbability) int {
+		switch {
+		case a.Probability > b.Probability:
+			return -1
+		case a.Probability < b.Probability:
+			return 1
+		}
+		return 0
+	})
+	return probabilities, nil
+}
+
+// autoLanguage detects the language a transcription is decoded in and returns
+// it with its probability. Audio without speech in the first window is
+// decoded in the first candidate language.
+func (whisperState *WhisperState) autoLanguage(logger *slog.Logger, source audioSource) (int32, float64, error) {
+	probabilities, err := whisperState.detectLanguage(logger, source, whisperState.detectLanguages)
+	if errors.Is(err, errNoSpeech) {
+		logger.Debug("No speech to detect the language from", "language", whisper.LanguageCode(whisperState.detectLanguages[0]))
+		return whisperState.detectLanguages[0], 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("detecting the language: %w", err)
+	}
+
+	logger.Debug("Language detected", "language", probabilities[0].Language, "probability", probabilities[0].Probability)
+	return probabilities[0].language, probabilities[0].Probability, nil
+}
+
+// DetectLanguage handles the language detection of an uploaded audio file
+func DetectLanguage(c echo.Context, whisperState *WhisperState) error {
+	if !whisperState.jobs.begin() {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": "Server is shutting down"})
+	}
+	defer whisperState.jobs.end()
+
+	logger := logging.FromContext(c.Request().Context())
+
+	if !whisperState.info.multilingual {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "the model only transcribes English and cannot detect the language"})
+	}
+
+	if err := whisperState.parseUpload(c); err != nil {
+		return err
+	}
+
+	top := defaultDetectTop
+	if value := c.FormValue("top"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxDetectCandidates {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid top %q, expected a number from 1 to %d", value, maxDetectCandidates)})
+		}
+		top = n
+	}
+
+	candidates := whisperState.detectLanguages
+	if value := c.FormValue("candidates"); value != "" {
+		var err error
+		if candidates, err = parseCandidates(value); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
+	source, cleanup, err := whisperState.receiveAudio(c, logger, false)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	probabilities, err := whisperState.detectLanguage(logger, source, candidates)
+
+	if errors.Is(err, errNoSpeech) {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	}
+
+	if errors.Is(err, errCancelled) {
+		return c.JSON(http.StatusServiceUnavailable, map[string]string{"error": err.Error()})
+	}
+
+	if err != nil {
+		logger.Error("Error detecting the language", "error", err)
+		whisperState.lastError.set(err)
+		return err
+	}
+
+	codes := make([]string, len(candidates))
+	for i, language := range candidates {
+		codes[i] = whisper.LanguageCode(language)
+	}
+
+	return c.JSON(http.StatusOK, DetectLanguageResponse{
+		Language:      probabilities[0].Language,
+		Probabilities: probabilities[:min(top, len(probabilities))],
+		Candidates:    codes,
+	})
+}
+
+// parseCandidates parses the comma separated languages a detection compares
+func parseCandidates(value string) ([]int32, error) {
+	var candidates []int32
+	for _, name := range ParseList(value) {
+		language, err := parseLanguage(name)
+		if err != nil {
+			return nil, err
+		}
+		if language == int32(whisper.Auto) {
+			return nil, fmt.Errorf("%w: auto is not a candidate language", errInvalidOption)
+		}
+		if !slices.Contains(candidates, language) {
+			candidates = append(candidates, language)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("%w: candidates lists no language", errInvalidOption)
+	}
+	if len(candidates) > maxDetectCandidates {
+		return nil, fmt.Errorf("%w: candidates lists %d languages, at most %d are compared", errInvalidOption, len(candidates), maxDetectCandidates)
+	}
+	return candidates, nil
+}
+
+// Languages lists the languages the loaded model transcribes
+func Languages(c echo.Context, whisperState *WhisperState) error {
+	response := LanguagesResponse{Default: whisper.LanguageCode(whisperState.language)}
+	if whisperState.language == int32(whisper.Auto) {
+		response.Default = "auto"
+	}
+
+	for _, l := range whisper.Languages() {
+		if !whisperState.info.multilingual && l.Value != whisper.English {
+			continue
+		}
+		response.Languages = append(response.Languages, LanguageInfo{Code: l.Code(), Name: l.Name, NativeName: l.NativeName})
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
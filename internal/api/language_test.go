@@ -0,0 +1,44 @@
+package api
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+func TestParseCandidates(t *testing.T) {
+	var many []string
+	for _, l := range whisper.Languages()[:maxDetectCandidates+1] {
+		many = append(many, l.Code())
+	}
+
+	tests := []struct {
+		value string
+		want  []int32
+		valid bool
+	}{
+		{"de", []int32{whisper.German}, true},
+		{"de, German ,es,de", []int32{whisper.German, whisper.Spanish}, true},
+		{"auto", nil, false},
+		{"xx", nil, false},
+		{",", nil, false},
+		{strings.Join(many[:maxDetectCandidates], ","), nil, true},
+		{strings.Join(many, ","), nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseCandidates(tt.value)
+		if tt.valid != (err == nil) {
+			t.Errorf("parseCandidates(%q) error %v, want valid %v", tt.value, err, tt.valid)
+			continue
+		}
+		if err != nil && !errors.Is(err, errInvalidOption) {
+			t.Errorf("parseCandidates(%q) error %v, want %v", tt.value, err, errInvalidOption)
+		}
+		if tt.want != nil && !slices.Equal(got, tt.want) {
+			t.Errorf("parseCandidates(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
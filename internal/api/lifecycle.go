@@ -0,0 +1,218 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+)
+
+// errCancelled is returned by transcriptions aborted during shutdown
+var errCancelled = errors.New("transcription cancelled")
+
+// jobTracker counts running transcriptions, so a shutdown can stop accepting
+// new ones and wait for the rest
+type jobTracker struct {
+	mutex     sync.Mutex
+	running   sync.WaitGroup
+	draining  bool
+	cancelled atomic.Bool
+	stop      chan struct{} // Closed when cancelled is set
+
+	tempFiles map[string]struct{}
+
+	// Checkpoints of the running transcriptions, by the number of jobs using them
+	checkpoints map[string]int
+}
+
+// begin registers a new job, it returns false once the server is draining
+func (t *jobTracker) begin() bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.draining {
+		return false
+	}
+	t.running.Add(1)
+	return true
+}
+
+func (t *jobTracker) end() {
+	t.running.Done()
+}
+
+// stopped returns a channel which is closed once the jobs are cancelled
+func (t *jobTracker) stopped() <-chan struct{} {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.stop == nil {
+		t.stop = make(chan struct{})
+	}
+	return t.stop
+}
+
+// cancel aborts the running jobs
+func (t *jobTracker) cancel() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.cancelled.Swap(true) {
+		return
+	}
+	if t.stop == nil {
+		t.stop = make(chan struct{})
+	}
+	close(t.stop)
+}
+
+// trackTempFile records a file which is removed on shutdown at the latest
+func (t *jobTracker) trackTempFile(path string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.tempFiles == nil {
+		t.tempFiles = make(map[string]struct{})
+	}
+	t.tempFiles[path] = struct{}{}
+}
+
+// removeTempFile removes a file recorded with trackTempFile
+func (t *jobTracker) removeTempFile(path string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("Error removing temp file", "path", path, "error", err)
+	}
+	delete(t.tempFiles, path)
+}
+
+// holdCheckpoint records a checkpoint a running job resumes from and saves to,
+// the sweeper keeps it until releaseCheckpoint
+func (t *jobTracker) holdCheckpoint(path string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.checkpoints == nil {
+		t.checkpoints = make(map[string]int)
+	}
+	t.checkpoints[path]++
+}
+
+func (t *jobTracker) releaseCheckpoint(path string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.checkpoints[path]--; t.checkpoints[path] <= 0 {
+		delete(t.checkpoints, path)
+	}
+}
+
+// inUse reports whether a running job uses the file, as an upload or as a
+// checkpoint
+func (t *jobTracker) inUse(path string) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	path = filepath.Clean(path)
+	for p := range t.tempFiles {
+		if filepath.Clean(p) == path {
+			return true
+		}
+	}
+	for p := range t.checkpoints {
+		if filepath.Clean(p) == path {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *jobTracker) removeTempFiles() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for path := range t.tempFiles {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("Error removing temp file", "path", path, "error", err)
+		}
+	}
+	t.tempFiles = nil
+}
+
+// Drain stops accepting new transcriptions
+func (whisperState *WhisperState) Drain() {
+	whisperState.jobs.mutex.Lock()
+	defer whisperState.jobs.mutex.Unlock()
+
+	whisperState.jobs.draining = true
+}
+
+// Draining reports whether the server stopped accepting new transcriptions
+func (whisperState *WhisperState) Draining() bool {
+	whisperState.jobs.mutex.Lock()
+	defer whisperState.jobs.mutex.Unlock()
+
+	return whisperState.jobs.draining
+}
+
+// Wait waits for the running transcriptions. It returns false if the context
+// is done first.
+func (whisperState *WhisperState) Wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		whisperState.jobs.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Cancel aborts the running transcriptions before their next encoder run
+func (whisperState *WhisperState) Cancel() {
+	whisperState.jobs.cancel()
+}
+
+// jobContext returns a context which is also cancelled by Cancel, for the
+// work of a transcription outside the engine such as the translation
+func (whisperState *WhisperState) jobContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-whisperState.jobs.stopped():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// Close releases the Whisper objects and removes the temp files. It must only
+// be called once no transcription is running.
+func (whisperState *WhisperState) Close() {
+	if whisperState.closed.Swap(true) {
+		return
+	}
+
+	// The contexts reference the model, release them first
+	for i := 0; i < cap(whisperState.workers); i++ {
+		w := <-whisperState.workers
+		w.context.Release()
+	}
+	whisperState.model.Release()
+	whisperState.media.Release()
+
+	if whisperState.stopSweeper != nil {
+		close(whisperState.stopSweeper)
+	}
+	whisperState.jobs.removeTempFiles()
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	// errAudioTooLong is returned when the audio exceeds the maximum duration
+	errAudioTooLong = errors.New("audio is too long")
+
+	// errUnsupportedMedia is returned when the upload is not a known audio or video container
+	errUnsupportedMedia = errors.New("unsupported media type, expected an audio file")
+)
+
+// Number of bytes read from an upload to detect its format
+const sniffLength = 64
+
+// Uploads up to this size are parsed in memory, larger ones are spooled to disk
+const multipartMemory = 32 << 20
+
+// audioSignature identifies a container format by the bytes at an offset
+type audioSignature struct {
+	offset int
+	magic  []byte
+}
+
+var audioSignatures = []audioSignature{
+	{0, []byte("ID3")},                  // MP3 with ID3v2 tag
+	{0, []byte("OggS")},                 // Ogg Vorbis / Opus
+	{0, []byte("fLaC")},                 // FLAC
+	{0, []byte("#!AMR")},                // AMR
+	{0, []byte("caff")},                 // Core Audio
+	{0, []byte{0x1A, 0x45, 0xDF, 0xA3}}, // Matroska / WebM
+	{0, []byte{0x30, 0x26, 0xB2, 0x75, 0x8E, 0x66, 0xCF, 0x11}}, // ASF: WMA / WMV
+	{4, []byte("ftyp")}, // MP4 / M4A / 3GP
+	{8, []byte("WAVE")}, // RIFF WAVE
+	{8, []byte("AVI ")}, // RIFF AVI
+	{8, []byte("AIFF")}, // AIFF
+	{8, []byte("AIFC")}, // AIFF-C
+}
+
+// isAudio reports whether the header starts with a supported audio or video container
+func isAudio(header []byte) bool {
+	for _, sig := range audioSignatures {
+		end := sig.offset + len(sig.magic)
+		if len(header) >= end && bytes.Equal(header[sig.offset:end], sig.magic) {
+			return true
+		}
+	}
+
+	// MPEG audio or AAC ADTS frame without a tag: 11 or 12 bits of frame sync
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0
+}
+
+// parseUpload enforces the upload limit and parses the multipart form. It runs
+// before any form value is read: reading one parses the whole body, which
+// writes the upload to disk. Client errors are returned as echo.HTTPError.
+func (whisperState *WhisperState) parseUpload(c echo.Context) error {
+	request := c.Request()
+	if limit := whisperState.maxUploadSize; limit > 0 {
+		if request.ContentLength > limit {
+			return uploadTooLarge(limit)
+		}
+		request.Body = http.MaxBytesReader(c.Response(), request.Body, limit)
+	}
+
+	if err := request.ParseMultipartForm(multipartMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return uploadTooLarge(maxBytesErr.Limit)
+		}
+		return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid multipart form: %s", err))
+	}
+	return nil
+}
+
+func uploadTooLarge(limit int64) error {
+	return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("upload exceeds the limit of %d bytes", limit))
+}
+
+// sniffFormFile rejects uploads which are not audio by their magic bytes
+func sniffFormFile(file *multipart.FileHeader) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	ok, err := sniffAudio(src)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errUnsupportedMedia
+	}
+	return nil
+}
+
+// IsAudioFile reports whether the file is a supported audio or video container
+func IsAudioFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	return sniffAudio(file)
+}
+
+func sniffAudio(r io.Reader) (bool, error) {
+	header := make([]byte, sniffLength)
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+	return isAudio(header[:n]), nil
+}
+
+// checkDuration rejects audio longer than max, 0 disables the check
+func checkDuration(ticks uint64, max time.Duration) error {
+	if max <= 0 {
+		return nil
+	}
+
+	duration := ticksDuration(ticks)
+	if duration > max {
+		return fmt.Errorf("%w: %s exceeds the limit of %s", errAudioTooLong, duration.Round(time.Second), max)
+	}
+	return nil
+}
+
+// ticksDuration converts 100-nanoseconds ticks used by Media Foundation to a duration
+func ticksDuration(ticks uint64) time.Duration {
+	return time.Duration(ticks) * 100
+}
+
+// samplesDuration converts a number of 16 kHz PCM samples to a duration
+func samplesDuration(samples uint32) time.Duration {
+	return time.Duration(samples) * time.Second / 16000
+}
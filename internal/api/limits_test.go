@@ -0,0 +1,56 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestUploadLimit sends a chunked upload larger than the limit, with the form
+// values before the file, and expects it rejected before it is parsed
+func TestUploadLimit(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("response_format", "json")
+	form.WriteField("top", "3")
+	file, err := form.CreateFormFile("file", "audio.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write([]byte("ID3"))
+	file.Write(make([]byte, 64<<10))
+	form.Close()
+
+	state := &WhisperState{maxUploadSize: 1 << 10, info: engineInfo{multilingual: true}}
+	tests := []struct {
+		name    string
+		handler echo.HandlerFunc
+	}{
+		{"transcriptions", func(c echo.Context) error { return TranscribeFromFile(c, state) }},
+		{"detect-language", func(c echo.Context) error { return DetectLanguage(c, state) }},
+	}
+
+	for _, tt := range tests {
+		e := echo.New()
+		e.HTTPErrorHandler = ErrorHandler
+		e.POST("/", tt.handler)
+
+		// Hiding the type of the reader leaves the content length unknown
+		request := httptest.NewRequest(http.MethodPost, "/", io.MultiReader(bytes.NewReader(body.Bytes())))
+		request.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+		if request.ContentLength != -1 {
+			t.Fatalf("content length %d, want a chunked request", request.ContentLength)
+		}
+
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("%s: status %d, want %d\n%s", tt.name, recorder.Code, http.StatusRequestEntityTooLarge, recorder.Body)
+		}
+	}
+}
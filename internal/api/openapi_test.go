@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xzeldon/whisper-api-server/internal/openapi"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+// TestRoutesDocumented checks that the registered routes and the paths of the
+// specification are the same
+func TestRoutesDocumented(t *testing.T) {
+	var spec struct {
+		Paths map[string]map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(openapi.Spec(), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	var documented []string
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	e := echo.New()
+	Routes(e, &WhisperState{})
+	var registered []string
+	for _, route := range e.Routes() {
+		registered = append(registered, route.Method+" "+route.Path)
+	}
+
+	slices.Sort(documented)
+	slices.Sort(registered)
+	if !slices.Equal(documented, registered) {
+		t.Errorf("the specification documents\n%v\nthe server registers\n%v", documented, registered)
+	}
+}
+
+// TestResponsesMatchSpec calls the handlers which do not need a loaded engine
+// and checks their responses against the schemas of the specification
+func TestResponsesMatchSpec(t *testing.T) {
+	state := &WhisperState{
+		language: int32(whisper.Auto),
+		info: engineInfo{
+			modelPath:    "ggml-medium.bin",
+			multilingual: true,
+			startedAt:    time.Now(),
+		},
+	}
+	state.lastError.set(errors.New("decoding failed"))
+
+	tests := []struct {
+		name    string
+		handler echo.HandlerFunc
+		status  int
+		schema  string
+	}{
+		{"health", Health, http.StatusOK, "Health"},
+		{"readiness", func(c echo.Context) error { return Ready(c, state) }, http.StatusServiceUnavailable, "Readiness"},
+		{"status", func(c echo.Context) error { return Status(c, state) }, http.StatusOK, "Status"},
+		{"languages", func(c echo.Context) error { return Languages(c, state) }, http.StatusOK, "Languages"},
+		{"error", func(echo.Context) error { return echo.NewHTTPError(http.StatusBadRequest, "invalid language") }, http.StatusBadRequest, "Error"},
+		{"internal error", func(echo.Context) error { return errors.New("failed") }, http.StatusInternalServerError, "Error"},
+	}
+
+	for _, tt := range tests {
+		e := echo.New()
+		e.HTTPErrorHandler = ErrorHandler
+		e.GET("/", tt.handler)
+
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if recorder.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, recorder.Code, tt.status)
+		}
+		if err := openapi.Validate(tt.schema, recorder.Body.Bytes()); err != nil {
+			t.Errorf("%s does not match %s: %v\n%s", tt.name, tt.schema, err, recorder.Body.Bytes())
+		}
+	}
+}
+
+// TestBodiesMatchSpec checks the response types which need audio against the
+// schemas of the specification
+func TestBodiesMatchSpec(t *testing.T) {
+	tests := []struct {
+		schema string
+		body   any
+	}{
+		{"SpeechRegions", SpeechResponse{Duration: 10, SpeechDuration: 4, Regions: []SpeechRegion{{Start: 1, End: 5}}}},
+		{"LanguageDetection", DetectLanguageResponse{Language: "de", Probabilities: []LanguageProbability{{Language: "de", Probability: 0.9}}, Candidates: []string{"en", "de"}}},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := openapi.Validate(tt.schema, data); err != nil {
+			t.Errorf("%T does not match %s: %v\n%s", tt.body, tt.schema, err, data)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"time"
+	"unsafe"
+
+	"github.com/xzeldon/whisper-api-server/internal/metrics"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/internal/vad"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+// worker is a Whisper context with its own parameters. A transcription holds
+// a worker for its whole run, the workers share the model and Media Foundation.
+type worker struct {
+	context *whisper.IContext
+	params  *whisper.FullParams
+
+	// Whether the last run of the context failed, only read and written by
+	// the transcription holding the worker
+	failed bool
+}
+
+func (whisperState *WhisperState) newWorker(strategy string, language int32) (*worker, error) {
+	samplingStrategy, err := whisper.ParseSamplingStrategy(strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	context, err := whisperState.model.CreateContext()
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := context.FullDefaultParams(samplingStrategy)
+	if err != nil {
+		context.Release()
+		return nil, err
+	}
+
+	params.SetLanguage(language)
+
+	// Called before every encoder run, lets a shutdown abort a running transcription
+	params.SetEncoderBeginCallback(func(*whisper.IContext, unsafe.Pointer) whisper.EWhisperHWND {
+		if whisperState.jobs.cancelled.Load() {
+			return whisper.S_FALSE
+		}
+		return whisper.S_OK
+	})
+
+	return &worker{context: context, params: params}, nil
+}
+
+// acquire waits for a free worker
+func (whisperState *WhisperState) acquire() *worker {
+	metrics.QueueDepth.Inc()
+	queued := time.Now()
+	w := <-whisperState.workers
+	metrics.QueueDepth.Dec()
+	metrics.QueueWait.Observe(time.Since(queued).Seconds())
+	return w
+}
+
+func (whisperState *WhisperState) release(w *worker) {
+	whisperState.workers <- w
+}
+
+// runResult records whether a run of the context of the worker failed and
+// returns err. A context whose last run failed counts as lost for the readiness
+// probe until it runs successfully again. The caller holds the worker.
+func (whisperState *WhisperState) runResult(w *worker, err error) error {
+	failed := err != nil && !whisperState.jobs.cancelled.Load()
+	if failed != w.failed {
+		w.failed = failed
+		if failed {
+			whisperState.lostContexts.Add(1)
+		} else {
+			whisperState.lostContexts.Add(-1)
+		}
+	}
+	return err
+}
+
+// Workers returns the number of transcriptions which run in parallel
+func (whisperState *WhisperState) Workers() int {
+	return cap(whisperState.workers)
+}
+
+// transcribe decodes the audio and reads the transcript. Long audio files are
+// transcribed in chunks when chunkLength is set.
+func (whisperState *WhisperState) transcribe(ctx context.Context, logger *slog.Logger, opts TranscribeOptions, source audioSource) (*transcript.Transcript, error) {
+	prompt, err := whisperState.promptText(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := whisperState.resultFilters(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	language, err := whisperState.requestLanguage(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := whisperState.checkTranslation(opts); err != nil {
+		return nil, err
+	}
+
+	// Tag the messages of the native library with the request. The library
+	// has a single logger, so this is only possible without parallel runs.
+	if whisperState.Workers() == 1 {
+		whisper.SetLogger(logger)
+		defer whisper.SetLogger(nil)
+	}
+
+	started := time.Now()
+	settings := decoding{prompt: prompt, language: language}
+	probability := 1.0
+	if language == int32(whisper.Auto) {
+		settings.language, probability, err = whisperState.autoLanguage(logger, source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result *transcript.Transcript
+	var duration time.Duration
+	if whisperState.chunked(opts, source) {
+		result, duration, err = whisperState.transcribeChunked(logger, opts, settings, source.path)
+	} else {
+		result, duration, err = whisperState.transcribeWhole(logger, opts, settings, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	metrics.ObserveTranscription(duration, time.Since(started))
+
+	if removed := result.Filter(filters, whisperState.filterOptions); removed > 0 {
+		logger.Debug("Filters removed segments", "segments", removed)
+	}
+
+	result.Task = "transcribe"
+	result.Language = whisper.LanguageCode(settings.language)
+	result.LanguageProbability = probability
+	result.Duration = duration
+
+	if opts.TargetLanguage != 0 && opts.TargetLanguage != settings.language {
+		if err := whisperState.translateResult(ctx, logger, result, settings.language, opts.TargetLanguage); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// transcribeWhole decodes the audio in a single run on a free worker. It
+// returns the transcript and the duration of the audio.
+func (whisperState *WhisperState) transcribeWhole(logger *slog.Logger, opts TranscribeOptions, settings decoding, source audioSource) (*transcript.Transcript, time.Duration, error) {
+	w := whisperState.acquire()
+	defer whisperState.release(w)
+
+	if err := whisperState.prepare(w, settings); err != nil {
+		return nil, 0, err
+	}
+
+	var result *transcript.Transcript
+	var duration time.Duration
+	var err error
+	if whisperState.vadMode(opts) == vad.ModeOn && source.path != "" {
+		result, duration, err = whisperState.runSpeech(logger, w, source.path)
+	} else {
+		duration, err = whisperState.decode(w, source)
+		if err == nil && !whisperState.jobs.cancelled.Load() {
+			result, err = getResult(w.context)
+		}
+	}
+	if whisperState.jobs.cancelled.Load() {
+		return nil, 0, errCancelled
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if whisperState.fallbackOptions.Enabled {
+		if err := whisperState.fallback(logger, w, result, duration, source); err != nil {
+			return nil, 0, err
+		}
+	}
+	return result, duration, nil
+}
+
+// TranscribeFile transcribes an audio file on disk. ctx aborts the work of the
+// transcription outside the engine, Cancel aborts the engine.
+func (whisperState *WhisperState) TranscribeFile(ctx context.Context, logger *slog.Logger, path string, opts TranscribeOptions) (*transcript.Transcript, error) {
+	if !whisperState.jobs.begin() {
+		return nil, errCancelled
+	}
+	defer whisperState.jobs.end()
+
+	return whisperState.transcribe(ctx, logger, opts, audioSource{path: path})
+}
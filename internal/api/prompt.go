@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/xzeldon/whisper-api-server/internal/vad"
+)
+
+// errInvalidOption is returned for a transcription option with an invalid value
+var errInvalidOption = errors.New("invalid option")
+
+// Number of prompt tokens the decoder keeps, half of its text context. Longer
+// prompts are cut at the beginning, like the OpenAI API does.
+const maxPromptTokens = 223
+
+// TranscribeOptions holds the per request settings of a transcription
+type TranscribeOptions struct {
+	// Text the transcription continues from, e.g. the previous sentences or
+	// the spelling of names
+	Prompt string
+
+	// Names of the glossaries whose terms are added to the prompt, in
+	// addition to the default glossaries
+	Glossaries []string
+
+	// Names of the filters applied to the result instead of the default
+	// filters, nil for the defaults and "none" for no filter
+	Filters []string
+
+	// Whether only the detected speech is transcribed, empty for the default
+	VAD vad.Mode
+
+	// Language of the audio, 0 for the default and whisper.Auto to detect it
+	Language int32
+
+	// Language the transcript is translated into, 0 for no translation
+	TargetLanguage int32
+}
+
+// decoding holds the settings a worker is prepared with for a transcription
+type decoding struct {
+	prompt   string
+	language int32
+}
+
+// prepare sets the prompt and the language of the transcription on the worker
+func (whisperState *WhisperState) prepare(w *worker, settings decoding) error {
+	w.params.SetLanguage(settings.language)
+	if err := whisperState.setPrompt(w, settings.prompt); err != nil {
+		return fmt.Errorf("tokenizing prompt: %w", err)
+	}
+	return nil
+}
+
+// promptText builds the initial prompt from the glossary terms and the prompt
+// of the request. The prompt comes last, as the decoder favours recent text.
+func (whisperState *WhisperState) promptText(opts TranscribeOptions) (string, error) {
+	var parts []string
+	seen := make(map[string]bool)
+
+	names := append(append([]string(nil), whisperState.defaultGlossaries...), opts.Glossaries...)
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		terms, ok := whisperState.glossaries[name]
+		if !ok {
+			return "", fmt.Errorf("%w: unknown glossary %q", errInvalidOption, name)
+		}
+		if len(terms) > 0 {
+			parts = append(parts, strings.Join(terms, ", ")+".")
+		}
+	}
+
+	if prompt := strings.TrimSpace(opts.Prompt); prompt != "" {
+		parts = append(parts, prompt)
+	}
+
+	return strings.Join(parts, " "), nil
+}
+
+// setPrompt tokenizes the prompt and sets it on the worker, an empty prompt
+// clears the prompt of the previous transcription
+func (whisperState *WhisperState) setPrompt(w *worker, prompt string) error {
+	if prompt == "" {
+		w.params.SetPrompt(nil)
+		return nil
+	}
+
+	tokens, err := whisperState.model.Tokenize(" " + prompt)
+	if err != nil {
+		return err
+	}
+	if len(tokens) > maxPromptTokens {
+		tokens = tokens[len(tokens)-maxPromptTokens:]
+	}
+
+	w.params.SetPrompt(tokens)
+	return nil
+}
+
+// ParseList splits a comma separated form value
+func ParseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/xzeldon/whisper-api-server/internal/metrics"
+)
+
+// Routes registers the routes of the HTTP API, every one of them is described
+// by the OpenAPI specification
+func Routes(e *echo.Echo, whisperState *WhisperState) {
+	e.POST("/v1/audio/transcriptions", func(c echo.Context) error {
+		return TranscribeFromFile(c, whisperState)
+	})
+	e.POST("/v1/audio/detect-language", func(c echo.Context) error {
+		return DetectLanguage(c, whisperState)
+	})
+	e.GET("/v1/languages", func(c echo.Context) error {
+		return Languages(c, whisperState)
+	})
+	e.GET("/metrics", metrics.Handler)
+	e.GET("/healthz", Health)
+	e.GET("/readyz", func(c echo.Context) error {
+		return Ready(c, whisperState)
+	})
+	e.GET("/v1/status", func(c echo.Context) error {
+		return Status(c, whisperState)
+	})
+	e.GET("/openapi.json", OpenAPI)
+	e.GET("/docs", Docs)
+}
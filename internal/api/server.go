@@ -0,0 +1,237 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListenOptions configures where the server accepts connections
+type ListenOptions struct {
+	Host string
+	Port int
+
+	// Unix domain socket path. When set, the server listens on it instead of Host and Port
+	Socket string
+
+	// PEM encoded certificate and key. The files are reloaded when they change
+	TLSCert string
+	TLSKey  string
+
+	// Serve HTTPS with a generated self-signed certificate, for development only
+	TLSSelfSigned bool
+}
+
+// Start starts the server according to the options and blocks until it is stopped
+func Start(e *echo.Echo, opts ListenOptions) error {
+	tlsConfig, err := opts.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	e.HidePort = true
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
+	if opts.Socket != "" {
+		listener, err := listenUnix(opts.Socket)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(opts.Socket)
+		slog.Info("Server started", "socket", opts.Socket, "scheme", scheme)
+
+		if tlsConfig == nil {
+			e.Listener = listener
+			return e.Start("")
+		}
+
+		e.TLSListener = tls.NewListener(listener, tlsConfig)
+	}
+
+	address := net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
+	if opts.Socket == "" {
+		slog.Info("Server started", "address", address, "scheme", scheme)
+	}
+
+	if tlsConfig == nil {
+		return e.Start(address)
+	}
+
+	e.TLSServer.Addr = address
+	e.TLSServer.TLSConfig = tlsConfig
+	return e.StartServer(e.TLSServer)
+}
+
+// listenUnix listens on the socket path, removing a socket left over by a previous run
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+func (opts ListenOptions) tlsConfig() (*tls.Config, error) {
+	switch {
+	case opts.TLSSelfSigned && (opts.TLSCert != "" || opts.TLSKey != ""):
+		return nil, errors.New("a self-signed certificate cannot be combined with a certificate file")
+	case opts.TLSSelfSigned:
+		cert, err := selfSignedCertificate(opts.Host)
+		if err != nil {
+			return nil, err
+		}
+		slog.Warn("Serving HTTPS with a self-signed certificate, do not use it in production")
+		return &tls.Config{
+			MinVersion:   tls.VersionTLS12,
+			Certificates: []tls.Certificate{*cert},
+		}, nil
+	case opts.TLSCert != "" && opts.TLSKey != "":
+		reloader, err := newCertReloader(opts.TLSCert, opts.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		return &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: reloader.GetCertificate,
+		}, nil
+	case opts.TLSCert != "" || opts.TLSKey != "":
+		return nil, errors.New("both a TLS certificate and a key are required")
+	}
+
+	return nil, nil
+}
+
+// certReloader serves a certificate from disk and reloads it when the
+// certificate or key file is modified, e.g. by a certificate renewal job
+type certReloader struct {
+	certPath string
+	keyPath  string
+
+	mutex     sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+// Interval between checks of the files for modifications
+const certCheckInterval = 10 * time.Second
+
+func newCertReloader(certPath string, keyPath string) (*certReloader, error) {
+	reloader := &certReloader{certPath: certPath, keyPath: keyPath}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if time.Since(r.checkedAt) >= certCheckInterval {
+		r.checkedAt = time.Now()
+		if err := r.reload(); err != nil {
+			// Keep serving the previous certificate until the files are fixed
+			slog.Error("Error reloading TLS certificate", "error", err)
+		}
+	}
+
+	return r.cert, nil
+}
+
+func (r *certReloader) reload() error {
+	modTime, err := latestModTime(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+	if r.cert != nil && !modTime.After(r.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+	if err != nil {
+		return err
+	}
+
+	if r.cert != nil {
+		slog.Info("TLS certificate reloaded", "path", r.certPath)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+func latestModTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// selfSignedCertificate generates a certificate valid for localhost and the given host
+func selfSignedCertificate(host string) (*tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"whisper-api-server development"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if !ip.IsUnspecified() {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		}
+	} else if host != "" && host != "localhost" {
+		template.DNSNames = append(template.DNSNames, host)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  key,
+	}, nil
+}
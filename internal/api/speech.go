@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/internal/vad"
+)
+
+// SpeechRegion is a part of the audio which contains speech, in seconds
+type SpeechRegion struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// SpeechResponse is the body of a request with vad=regions
+type SpeechResponse struct {
+	Duration       float64        `json:"duration"`
+	SpeechDuration float64        `json:"speech_duration"`
+	Regions        []SpeechRegion `json:"regions"`
+}
+
+// vadMode returns the speech detection mode of the options, or the default
+// mode of the server
+func (whisperState *WhisperState) vadMode(opts TranscribeOptions) vad.Mode {
+	if opts.VAD == "" {
+		return whisperState.defaultVAD
+	}
+	return opts.VAD
+}
+
+// runSpeech detects the speech in the audio file and transcribes only the
+// speech regions, each one as a window of the whole audio. It returns the
+// transcript and the duration of the audio. The caller holds the worker.
+func (whisperState *WhisperState) runSpeech(logger *slog.Logger, w *worker, audioPath string) (*transcript.Transcript, time.Duration, error) {
+	if err := whisperState.checkFileDuration(audioPath); err != nil {
+		return nil, 0, err
+	}
+
+	buffer, err := whisperState.media.LoadAudioFile(audioPath, true)
+	if err != nil {
+		return nil, 0, fmt.Errorf("loading audio file: %w", err)
+	}
+	defer buffer.Release()
+
+	samples, err := buffer.PcmMono()
+	if err != nil {
+		return nil, 0, fmt.Errorf("reading audio samples: %w", err)
+	}
+	duration := samplesDuration(uint32(len(samples)))
+
+	regions := vad.Detect(samples, vad.DefaultOptions())
+	logger.Debug("Speech detected", "regions", len(regions), "speech", vad.SpeechDuration(regions), "duration", duration)
+
+	result := &transcript.Transcript{}
+	defer w.params.SetWindow(0, 0)
+
+	for _, region := range regions {
+		w.params.SetWindow(int32(region.Start.Milliseconds()), int32((region.End - region.Start).Milliseconds()))
+		if err := whisperState.runResult(w, w.context.RunFull(w.params, buffer)); err != nil {
+			return nil, 0, err
+		}
+		if whisperState.jobs.cancelled.Load() {
+			return nil, 0, errCancelled
+		}
+
+		decoded, err := getResult(w.context)
+		if err != nil {
+			return nil, 0, err
+		}
+		result.Segments = append(result.Segments, windowSegments(decoded.Segments)...)
+	}
+
+	for i := range result.Segments {
+		result.Segments[i].ID = i
+	}
+	return result, duration, nil
+}
+
+// speechRegions responds with the speech regions of the audio file without
+// transcribing it. The detection does not need a Whisper context.
+func (whisperState *WhisperState) speechRegions(c echo.Context, logger *slog.Logger, audioPath string) error {
+	err := whisperState.checkFileDuration(audioPath)
+	if errors.Is(err, errAudioTooLong) {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		logger.Error("Error reading the audio duration", "error", err)
+		whisperState.lastError.set(err)
+		return err
+	}
+
+	buffer, err := whisperState.media.LoadAudioFile(audioPath, true)
+	if err != nil {
+		logger.Error("Error loading audio file", "error", err)
+		whisperState.lastError.set(err)
+		return err
+	}
+	defer buffer.Release()
+
+	samples, err := buffer.PcmMono()
+	if err != nil {
+		logger.Error("Error reading audio samples", "error", err)
+		whisperState.lastError.set(err)
+		return err
+	}
+
+	regions := vad.Detect(samples, vad.DefaultOptions())
+	response := SpeechResponse{
+		Duration:       samplesDuration(uint32(len(samples))).Seconds(),
+		SpeechDuration: vad.SpeechDuration(regions).Seconds(),
+		Regions:        make([]SpeechRegion, len(regions)),
+	}
+	for i, region := range regions {
+		response.Regions[i] = SpeechRegion{Start: region.Start.Seconds(), End: region.End.Seconds()}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
@@ -2,72 +2,298 @@ package api
 
 import (
 	"fmt"
-	"sync"
+	"log/slog"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/xzeldon/whisper-api-server/internal/metrics"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/internal/translate"
+	"github.com/xzeldon/whisper-api-server/internal/vad"
 	"github.com/xzeldon/whisper-api-server/pkg/whisper"
 )
 
 type WhisperState struct {
-	model   *whisper.Model
-	context *whisper.IContext
-	media   *whisper.IMediaFoundation
-	params  *whisper.FullParams
-	mutex   sync.Mutex
+	model  *whisper.Model
+	media  *whisper.IMediaFoundation
+	tmpDir string
+
+	// Pool of contexts, its capacity is the number of parallel transcriptions
+	workers chan *worker
+
+	// Default language of the transcriptions, whisper.Auto to detect it
+	language int32
+
+	// Languages compared by the language detection
+	detectLanguages []int32
+
+	// Named lists of terms added to the prompt
+	glossaries        map[string][]string
+	defaultGlossaries []string
+
+	fallbackOptions FallbackOptions
+
+	// Translates the transcripts into other languages, nil when not configured
+	translator translate.Translator
+
+	// Post-processing of the results
+	filters       []transcript.Filter
+	filterOptions transcript.FilterOptions
+
+	// Whether only the detected speech is transcribed
+	defaultVAD vad.Mode
+
+	// Files longer than chunkLength are transcribed in chunks, 0 disables it
+	chunkLength  time.Duration
+	chunkOverlap time.Duration
+
+	// Uploads up to this size are decoded from memory instead of a temp file
+	memoryDecodeLimit int64
+
+	maxUploadSize    int64
+	maxAudioDuration time.Duration
+
+	jobs        jobTracker
+	stopSweeper chan struct{}
+
+	info      engineInfo
+	closed    atomic.Bool
+	lastError errorRecord
+
+	// Number of contexts whose last run failed
+	lostContexts atomic.Int32
 }
 
-func InitializeWhisperState(modelPath string, lang int32) (*WhisperState, error) {
-	lib, err := whisper.New(whisper.LlDebug, whisper.LfUseStandardError, nil)
+// Options configures the Whisper engine
+type Options struct {
+	DllPath          string
+	ModelPath        string
+	Language         int32  // whisper.Auto to detect the language
+	LogLevel         string // error, warning, info or debug
+	SamplingStrategy string // greedy or beamSearch
+	GPU              string // GPU adapter name, empty for the default adapter
+	TmpDir           string // Directory for uploaded files
+
+	// Number of contexts, i.e. transcriptions running in parallel
+	Contexts int
+
+	// Languages compared by the language detection, the first one is used for
+	// audio without speech
+	DetectLanguages []int32
+
+	// Named lists of domain terms, e.g. product or drug names, which are added
+	// to the prompt to bias the spelling of the transcription
+	Glossaries map[string][]string
+
+	// Glossaries used by every transcription
+	DefaultGlossaries []string
+
+	// Decodes again the windows which look like a failed transcription
+	Fallback FallbackOptions
+
+	// Translates the transcripts of the requests with a target language, nil
+	// rejects them
+	Translator translate.Translator
+
+	// Filters applied to every result unless a request selects others
+	Filters []string
+
+	// Thresholds and phrase list of the filters
+	FilterOptions transcript.FilterOptions
+
+	// Transcribe only the detected speech unless a request selects otherwise,
+	// off or on
+	VAD vad.Mode
+
+	// Audio files longer than this are transcribed in overlapping chunks, 0
+	// transcribes every file in a single run
+	ChunkLength  time.Duration
+	ChunkOverlap time.Duration
+
+	// Uploads left in TmpDir are removed after this time, 0 disables the sweeper
+	TmpRetention time.Duration
+
+	// Uploads up to this size in bytes skip the disk, 0 always uses TmpDir
+	MemoryDecodeLimit int64
+
+	// Largest accepted upload in bytes, 0 for no limit
+	MaxUploadSize int64
+
+	// Longest accepted audio, 0 for no limit
+	MaxAudioDuration time.Duration
+}
+
+func InitializeWhisperState(opts Options) (*WhisperState, error) {
+	level, err := whisper.ParseLogLevel(opts.LogLevel)
 	if err != nil {
 		return nil, err
 	}
 
-	model, err := lib.LoadModel(modelPath)
+	for _, name := range opts.DefaultGlossaries {
+		if _, ok := opts.Glossaries[name]; !ok {
+			return nil, fmt.Errorf("unknown glossary %q", name)
+		}
+	}
+
+	if opts.ChunkLength > 0 && opts.ChunkOverlap*2 >= opts.ChunkLength {
+		return nil, fmt.Errorf("the chunk overlap %s must be shorter than half the chunk length %s", opts.ChunkOverlap, opts.ChunkLength)
+	}
+
+	if len(opts.DetectLanguages) == 0 {
+		return nil, fmt.Errorf("no languages to detect")
+	}
+	if len(opts.DetectLanguages) > maxDetectCandidates {
+		return nil, fmt.Errorf("%d languages to detect, at most %d are compared", len(opts.DetectLanguages), maxDetectCandidates)
+	}
+
+	filters, err := transcript.ParseFilters(opts.Filters)
 	if err != nil {
 		return nil, err
 	}
 
-	context, err := model.CreateContext()
+	lib, err := whisper.NewFromPath(opts.DllPath, level, whisper.LfNone, whisper.LoggerSink())
 	if err != nil {
 		return nil, err
 	}
 
-	media, err := lib.InitMediaFoundation()
+	contexts := max(opts.Contexts, 1)
+	if contexts > 1 && !lib.SupportsMultiThread() {
+		slog.Warn("This Whisper library version does not support parallel transcriptions, using a single context", "version", lib.WinVersion().String())
+		contexts = 1
+	}
+
+	loadStarted := time.Now()
+	model, err := lib.LoadModel(opts.ModelPath, opts.GPU)
 	if err != nil {
 		return nil, err
 	}
+	metrics.ModelLoadSeconds.Set(time.Since(loadStarted).Seconds(), filepath.Base(opts.ModelPath))
 
-	params, err := context.FullDefaultParams(whisper.SsBeamSearch)
+	media, err := lib.InitMediaFoundation()
 	if err != nil {
 		return nil, err
 	}
 
-	params.SetLanguage(lang)
-
-	fmt.Printf("Params CPU Threads : %d\n", params.CpuThreads())
-
-	return &WhisperState{
+	state := &WhisperState{
 		model:   model,
-		context: context,
 		media:   media,
-		params:  params,
-	}, nil
+		tmpDir:  opts.TmpDir,
+		workers: make(chan *worker, contexts),
+
+		language:        opts.Language,
+		detectLanguages: opts.DetectLanguages,
+
+		glossaries:        opts.Glossaries,
+		defaultGlossaries: opts.DefaultGlossaries,
+
+		fallbackOptions: opts.Fallback,
+
+		translator: opts.Translator,
+
+		filters:       filters,
+		filterOptions: opts.FilterOptions,
+
+		defaultVAD: vad.ModeOff,
+
+		chunkLength:  opts.ChunkLength,
+		chunkOverlap: opts.ChunkOverlap,
+
+		memoryDecodeLimit: opts.MemoryDecodeLimit,
+
+		maxUploadSize:    opts.MaxUploadSize,
+		maxAudioDuration: opts.MaxAudioDuration,
+	}
+
+	if opts.VAD != "" {
+		state.defaultVAD = opts.VAD
+	}
+
+	// English-only models cannot detect the language
+	if !model.IsMultilingual() && state.language != whisper.English {
+		language := whisper.LanguageCode(state.language)
+		if state.language == int32(whisper.Auto) {
+			language = "auto"
+		}
+		slog.Warn("The model only transcribes English, using English", "language", language)
+		state.language = whisper.English
+	}
+
+	var cpuThreads int32
+	for i := 0; i < contexts; i++ {
+		w, err := state.newWorker(opts.SamplingStrategy, state.language)
+		if err != nil {
+			return nil, err
+		}
+		cpuThreads = w.params.CpuThreads()
+		state.workers <- w
+	}
+
+	state.info = engineInfo{
+		version:      lib.WinVersion(),
+		multiThread:  lib.SupportsMultiThread(),
+		modelPath:    opts.ModelPath,
+		multilingual: model.IsMultilingual(),
+		gpu:          opts.GPU,
+		cpuThreads:   cpuThreads,
+		contexts:     contexts,
+		startedAt:    time.Now(),
+	}
+
+	if opts.TmpRetention > 0 {
+		state.stopSweeper = make(chan struct{})
+		go sweepTempFiles(opts.TmpDir, opts.TmpRetention, state.jobs.inUse, state.stopSweeper)
+	}
+
+	slog.Info("Whisper initialized", "version", state.info.version.String(), "model", opts.ModelPath, "contexts", contexts, "cpu_threads", cpuThreads)
+
+	return state, nil
 }
 
-func getResult(ctx *whisper.IContext) (string, error) {
-	results := &whisper.ITranscribeResult{}
-	ctx.GetResults(whisper.RfTokens|whisper.RfTimestamps, &results)
+// getResult reads the segments and tokens of the last transcription
+func getResult(ctx *whisper.IContext) (*transcript.Transcript, error) {
+	var results *whisper.ITranscribeResult
+	if hr := ctx.GetResults(whisper.RfTokens|whisper.RfTimestamps, &results); hr != 0 || results == nil {
+		return nil, fmt.Errorf("getting the results: %w", syscall.Errno(hr))
+	}
+	// The segments and tokens are copied before the result is released
+	defer results.Release()
 
 	length, err := results.GetSize()
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
 	segments := results.GetSegments(length.CountSegments)
+	tokens := results.GetTokens(length.CountTokens)
+
+	result := &transcript.Transcript{Segments: make([]transcript.Segment, 0, len(segments))}
+
+	for i, seg := range segments {
+		segment := transcript.Segment{
+			ID:    i,
+			Start: ticksDuration(seg.Time.Begin.Ticks),
+			End:   ticksDuration(seg.Time.End.Ticks),
+			Text:  seg.Text(),
+		}
 
-	var result string
+		first, last := int(seg.FirstToken), int(seg.FirstToken+seg.CountTokens)
+		if last <= len(tokens) {
+			for _, token := range tokens[first:last] {
+				segment.Tokens = append(segment.Tokens, transcript.Token{
+					ID:                   token.Id,
+					Text:                 token.Text(),
+					Start:                ticksDuration(token.Time.Begin.Ticks),
+					End:                  ticksDuration(token.Time.End.Ticks),
+					Probability:          token.Probability,
+					TimestampProbability: token.Ptsum,
+					Special:              token.Flags&whisper.TfSpecial != 0,
+				})
+			}
+		}
 
-	for _, seg := range segments {
-		result += seg.Text()
+		result.Segments = append(result.Segments, segment)
 	}
 
 	return result, nil
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/xzeldon/whisper-api-server/internal/metrics"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+// engineInfo describes the loaded engine. It is set once by InitializeWhisperState
+// so the probes never wait for a worker held by a running transcription.
+type engineInfo struct {
+	version      whisper.WinVersion
+	multiThread  bool
+	modelPath    string
+	multilingual bool
+	gpu          string
+	cpuThreads   int32
+	contexts     int
+	startedAt    time.Time
+}
+
+// errorRecord keeps the last error of a transcription
+type errorRecord struct {
+	mutex   sync.Mutex
+	message string
+	time    time.Time
+}
+
+func (r *errorRecord) set(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.message = err.Error()
+	r.time = time.Now()
+}
+
+func (r *errorRecord) get() *ErrorStatus {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.message == "" {
+		return nil
+	}
+	return &ErrorStatus{Message: r.message, Time: r.time}
+}
+
+type ErrorStatus struct {
+	Message string    `json:"message"`
+	Time    time.Time `json:"time"`
+}
+
+type ModelStatus struct {
+	Path         string `json:"path"`
+	Multilingual bool   `json:"multilingual"`
+}
+
+type StatusResponse struct {
+	Status              string       `json:"status"`
+	Version             string       `json:"version"`
+	SupportsMultiThread bool         `json:"supports_multi_thread"`
+	Model               ModelStatus  `json:"model"`
+	GPU                 string       `json:"gpu"`
+	UptimeSeconds       float64      `json:"uptime_seconds"`
+	QueueDepth          int          `json:"queue_depth"`
+	CPUThreads          int32        `json:"cpu_threads"`
+	Contexts            int          `json:"contexts"`
+	LastError           *ErrorStatus `json:"last_error"`
+}
+
+type ReadinessResponse struct {
+	Status string          `json:"status"`
+	Checks map[string]bool `json:"checks"`
+}
+
+// Health reports that the process is alive
+func Health(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready reports whether the server accepts transcriptions: the library and the
+// model are loaded, at least one context did not fail its last run and the
+// server is not shutting down
+func Ready(c echo.Context, whisperState *WhisperState) error {
+	checks := whisperState.readiness()
+
+	response := ReadinessResponse{Status: "ready", Checks: checks}
+	for _, ok := range checks {
+		if !ok {
+			response.Status = "not ready"
+			return c.JSON(http.StatusServiceUnavailable, response)
+		}
+	}
+
+	return c.JSON(http.StatusOK, response)
+}
+
+// Status reports the loaded engine and the workload of the server
+func Status(c echo.Context, whisperState *WhisperState) error {
+	info := whisperState.info
+
+	status := "ready"
+	if whisperState.Draining() {
+		status = "draining"
+	}
+
+	return c.JSON(http.StatusOK, StatusResponse{
+		Status:              status,
+		Version:             info.version.String(),
+		SupportsMultiThread: info.multiThread,
+		Model: ModelStatus{
+			Path:         info.modelPath,
+			Multilingual: info.multilingual,
+		},
+		GPU:           info.gpu,
+		UptimeSeconds: time.Since(info.startedAt).Seconds(),
+		QueueDepth:    int(metrics.QueueDepth.Value()),
+		CPUThreads:    info.cpuThreads,
+		Contexts:      info.contexts,
+		LastError:     whisperState.lastError.get(),
+	})
+}
+
+func (whisperState *WhisperState) readiness() map[string]bool {
+	closed := whisperState.closed.Load()
+
+	return map[string]bool{
+		"library":   !closed && whisperState.info.version.Major > 0,
+		"model":     !closed && whisperState.info.modelPath != "",
+		"context":   !closed && int(whisperState.lostContexts.Load()) < whisperState.info.contexts,
+		"accepting": !whisperState.Draining(),
+	}
+}
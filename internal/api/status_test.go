@@ -0,0 +1,35 @@
+package api
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+func TestReadinessContexts(t *testing.T) {
+	state := &WhisperState{info: engineInfo{
+		version:   whisper.WinVersion{Major: 1},
+		modelPath: "ggml-medium.bin",
+		contexts:  2,
+	}}
+	first, second := &worker{}, &worker{}
+
+	tests := []struct {
+		w     *worker
+		err   error
+		ready bool
+	}{
+		{first, nil, true},
+		{first, errors.New("device lost"), true},
+		{first, errors.New("device lost"), true},
+		{second, errors.New("device lost"), false},
+		{first, nil, true},
+	}
+	for i, tt := range tests {
+		state.runResult(tt.w, tt.err)
+		if ready := state.readiness()["context"]; ready != tt.ready {
+			t.Errorf("run %d: context ready %v, want %v", i, ready, tt.ready)
+		}
+	}
+}
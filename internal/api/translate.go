@@ -0,0 +1,63 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+// errTranslation is returned when the translation service fails
+var errTranslation = errors.New("translation failed")
+
+// checkTranslation rejects a target language when no translator is configured
+func (whisperState *WhisperState) checkTranslation(opts TranscribeOptions) error {
+	if opts.TargetLanguage == 0 {
+		return nil
+	}
+	if opts.TargetLanguage == int32(whisper.Auto) {
+		return fmt.Errorf("%w: the target language cannot be auto", errInvalidOption)
+	}
+	if whisperState.translator == nil {
+		return fmt.Errorf("%w: translation is not configured on the server", errInvalidOption)
+	}
+	return nil
+}
+
+// translateResult translates the text of every segment into the target
+// language. The segments keep their timing, so subtitles of the translation
+// line up with the audio, and their transcribed text is kept as SourceText.
+// The translation is aborted when ctx is done or the server shuts down.
+func (whisperState *WhisperState) translateResult(ctx context.Context, logger *slog.Logger, result *transcript.Transcript, source int32, target int32) error {
+	texts := make([]string, len(result.Segments))
+	for i, seg := range result.Segments {
+		texts[i] = strings.TrimSpace(seg.Text)
+	}
+
+	logger.Debug("Translating", "source", whisper.LanguageCode(source), "target", whisper.LanguageCode(target), "segments", len(texts))
+	ctx, cancel := whisperState.jobContext(ctx)
+	defer cancel()
+
+	translations, err := whisperState.translator.Translate(ctx, texts, whisper.ISOCode(source), whisper.ISOCode(target))
+	if whisperState.jobs.cancelled.Load() {
+		return errCancelled
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", errTranslation, err)
+	}
+
+	for i := range result.Segments {
+		seg := &result.Segments[i]
+		seg.SourceText = seg.Text
+		seg.Text = " " + strings.TrimSpace(translations[i])
+	}
+
+	result.Task = "translate"
+	result.SourceLanguage = result.Language
+	result.Language = whisper.LanguageCode(target)
+	return nil
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/internal/translate"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
+)
+
+func TestTranslateResult(t *testing.T) {
+	state := &WhisperState{translator: translate.Fake{}}
+	result := &transcript.Transcript{
+		Task:     "transcribe",
+		Language: "de",
+		Segments: []transcript.Segment{
+			{ID: 0, Start: 0, End: 2 * time.Second, Text: " Guten Morgen."},
+			{ID: 1, Start: 2500 * time.Millisecond, End: 4 * time.Second, Text: " Wie geht es?"},
+		},
+	}
+
+	if err := state.translateResult(context.Background(), slog.Default(), result, whisper.German, whisper.Spanish); err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Task != "translate" || result.Language != "es" || result.SourceLanguage != "de" {
+		t.Errorf("task %q, language %q, source language %q, want translate, es and de", result.Task, result.Language, result.SourceLanguage)
+	}
+
+	want := []transcript.Segment{
+		{ID: 0, Start: 0, End: 2 * time.Second, Text: " [es] Guten Morgen.", SourceText: " Guten Morgen."},
+		{ID: 1, Start: 2500 * time.Millisecond, End: 4 * time.Second, Text: " [es] Wie geht es?", SourceText: " Wie geht es?"},
+	}
+	for i, seg := range result.Segments {
+		w := want[i]
+		if seg.ID != w.ID || seg.Start != w.Start || seg.End != w.End || seg.Text != w.Text || seg.SourceText != w.SourceText {
+			t.Errorf("segment %d = %+v, want %+v", i, seg, w)
+		}
+	}
+}
+
+// blockingTranslator waits for the context of the translation
+type blockingTranslator struct{}
+
+func (blockingTranslator) Translate(ctx context.Context, _ []string, _ string, _ string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestTranslateResultCancelled(t *testing.T) {
+	newResult := func() *transcript.Transcript {
+		return &transcript.Transcript{Segments: []transcript.Segment{{Text: " Hallo"}}}
+	}
+
+	// The client goes away
+	state := &WhisperState{translator: blockingTranslator{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := state.translateResult(ctx, slog.Default(), newResult(), whisper.German, whisper.Spanish)
+	if !errors.Is(err, errTranslation) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("translateResult with an expired context = %v, want a translation error", err)
+	}
+
+	// The server shuts down
+	state = &WhisperState{translator: blockingTranslator{}}
+	time.AfterFunc(10*time.Millisecond, state.Cancel)
+	err = state.translateResult(context.Background(), slog.Default(), newResult(), whisper.German, whisper.Spanish)
+	if !errors.Is(err, errCancelled) {
+		t.Errorf("translateResult during shutdown = %v, want %v", err, errCancelled)
+	}
+}
@@ -2,46 +2,108 @@ package api
 
 import (
 	"io"
+	"log/slog"
+	"mime/multipart"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
-
-	"github.com/labstack/echo/v4"
 )
 
-func saveFormFile(name string, c echo.Context) (string, error) {
-	file, err := c.FormFile(name)
-	if err != nil {
-		return "", err
-	}
+// uploadPrefix is the name prefix of uploaded files in the tmp directory,
+// only files with this prefix are removed by the sweeper
+const uploadPrefix = "upload-"
 
+// saveFormFile writes the uploaded file to a uniquely named file in dir
+func saveFormFile(file *multipart.FileHeader, dir string) (string, error) {
 	src, err := file.Open()
 	if err != nil {
 		return "", err
 	}
 	defer src.Close()
 
-	tmpDir, err := ensureDir("tmp")
+	tmpDir, err := ensureDir(dir)
 	if err != nil {
 		return "", err
 	}
 
-	ext := filepath.Ext(file.Filename)
-	filename := time.Now().Format(time.RFC3339)
-	filename = tmpDir + "/" + sanitizeFilename(filename) + ext
-
-	dst, err := os.Create(filename)
+	ext := sanitizeFilename(filepath.Ext(file.Filename))
+	dst, err := os.CreateTemp(tmpDir, uploadPrefix+"*"+ext)
 	if err != nil {
 		return "", err
 	}
 	defer dst.Close()
 
 	if _, err = io.Copy(dst, src); err != nil {
+		os.Remove(dst.Name())
 		return "", err
 	}
 
-	return filename, nil
+	return dst.Name(), dst.Close()
+}
+
+// readFormFile reads the uploaded file into memory
+func readFormFile(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	return io.ReadAll(src)
+}
+
+// sweepTempFiles removes uploads and checkpoints older than the retention from
+// dir until stop is closed. Files are normally removed right after processing,
+// this catches the ones left behind by a crash. Files a running job uses are
+// kept however old they are.
+func sweepTempFiles(dir string, retention time.Duration, inUse func(path string) bool, stop <-chan struct{}) {
+	interval := retention / 2
+	if interval > 10*time.Minute {
+		interval = 10 * time.Minute
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		removeExpiredFiles(dir, retention, inUse)
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func removeExpiredFiles(dir string, retention time.Duration, inUse func(path string) bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), uploadPrefix) && !strings.HasPrefix(entry.Name(), checkpointPrefix) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < retention {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if inUse(path) {
+			continue
+		}
+		if err := os.Remove(path); err == nil {
+			slog.Info("Removed expired upload", "path", path)
+		}
+	}
 }
 
 func sanitizeFilename(filename string) string {
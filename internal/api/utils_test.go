@@ -0,0 +1,54 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-2 * time.Hour)
+
+	files := map[string]time.Time{
+		"upload-running.wav":      old,
+		"upload-left.wav":         old,
+		"upload-new.wav":          time.Now(),
+		"checkpoint-running.json": old,
+		"checkpoint-left.json":    old,
+		"other.wav":               old,
+	}
+	for name, modTime := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The running job was given a path which is not in its clean form
+	var jobs jobTracker
+	jobs.trackTempFile(dir + string(filepath.Separator) + "." + string(filepath.Separator) + "upload-running.wav")
+	jobs.holdCheckpoint(filepath.Join(dir, "checkpoint-running.json"))
+
+	removeExpiredFiles(dir, time.Hour, jobs.inUse)
+
+	for name := range files {
+		_, err := os.Stat(filepath.Join(dir, name))
+		removed := os.IsNotExist(err)
+		want := name == "upload-left.wav" || name == "checkpoint-left.json"
+		if removed != want {
+			t.Errorf("%s removed %v, want %v", name, removed, want)
+		}
+	}
+
+	// A released checkpoint expires like the others
+	jobs.releaseCheckpoint(filepath.Join(dir, "checkpoint-running.json"))
+	removeExpiredFiles(dir, time.Hour, jobs.inUse)
+	if _, err := os.Stat(filepath.Join(dir, "checkpoint-running.json")); !os.IsNotExist(err) {
+		t.Errorf("released checkpoint was kept: %v", err)
+	}
+}
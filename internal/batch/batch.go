@@ -0,0 +1,274 @@
+// Package batch transcribes local audio files with the engine of the server
+// and writes the transcripts next to them or into an output directory
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xzeldon/whisper-api-server/internal/api"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+)
+
+// Options configures a batch run
+type Options struct {
+	// Files, directories or glob patterns. Directories are searched recursively
+	Inputs []string
+
+	// Directory for the transcripts, empty to write them next to the inputs
+	OutputDir string
+
+	// Output formats, see ParseFormats
+	Formats []string
+
+	// Transcribe files whose transcripts are up to date
+	Force bool
+}
+
+// Run transcribes the inputs on the workers of the state, as many files in
+// parallel as the state has contexts. Cancelling ctx aborts the running
+// transcriptions. Failed files are logged and reported in the returned error.
+func Run(ctx context.Context, state *api.WhisperState, opts Options) error {
+	formats, err := ParseFormats(opts.Formats)
+	if err != nil {
+		return err
+	}
+
+	files, err := expandInputs(opts.Inputs)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("no audio files found")
+	}
+	if err := checkOutputs(files, opts.OutputDir); err != nil {
+		return err
+	}
+
+	if opts.OutputDir != "" {
+		if err := os.MkdirAll(opts.OutputDir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	stop := context.AfterFunc(ctx, state.Cancel)
+	defer stop()
+
+	var failed atomic.Int32
+	var wg sync.WaitGroup
+	paths := make(chan string)
+
+	for i := 0; i < state.Workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if err := transcribeFile(ctx, state, path, opts.OutputDir, formats); err != nil {
+					slog.Error("Error transcribing file", "file", path, "error", err)
+					failed.Add(1)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, path := range files {
+		if !opts.Force && UpToDate(path, opts.OutputDir, formats) {
+			slog.Info("Skipping file, the transcripts are up to date", "file", path)
+			continue
+		}
+
+		select {
+		case paths <- path:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(paths)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if n := failed.Load(); n > 0 {
+		return fmt.Errorf("%d of %d files failed", n, len(files))
+	}
+	return nil
+}
+
+func transcribeFile(ctx context.Context, state *api.WhisperState, path string, outputDir string, formats []transcript.Format) error {
+	logger := slog.Default().With("file", path)
+	logger.Info("Transcribing file")
+
+	result, err := state.TranscribeFile(ctx, logger, path, api.TranscribeOptions{})
+	if err != nil {
+		return err
+	}
+
+	if err := WriteOutputs(result, path, outputDir, formats); err != nil {
+		return err
+	}
+
+	logger.Info("File transcribed", "duration", result.Duration)
+	return nil
+}
+
+// ParseFormats converts output format names to transcript formats. txt is
+// accepted for the text format.
+func ParseFormats(names []string) ([]transcript.Format, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no output format given")
+	}
+
+	formats := make([]transcript.Format, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "txt" {
+			name = string(transcript.FormatText)
+		}
+
+		format, err := transcript.ParseFormat(name)
+		if err != nil {
+			return nil, err
+		}
+		formats = append(formats, format)
+	}
+	return formats, nil
+}
+
+// OutputPath returns the path of the transcript of input in the format
+func OutputPath(input string, outputDir string, format transcript.Format) string {
+	dir := outputDir
+	if dir == "" {
+		dir = filepath.Dir(input)
+	}
+
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	return filepath.Join(dir, name+format.Extension())
+}
+
+// UpToDate reports whether every transcript of input exists and is newer than it
+func UpToDate(input string, outputDir string, formats []transcript.Format) bool {
+	info, err := os.Stat(input)
+	if err != nil {
+		return false
+	}
+
+	for _, format := range formats {
+		out, err := os.Stat(OutputPath(input, outputDir, format))
+		if err != nil || out.ModTime().Before(info.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteOutputs writes the transcript of input in every format. Each file is
+// written under a temporary name first, so an interrupted run never leaves a
+// truncated transcript which would be taken as done.
+func WriteOutputs(result *transcript.Transcript, input string, outputDir string, formats []transcript.Format) error {
+	for _, format := range formats {
+		path := OutputPath(input, outputDir, format)
+		if err := writeOutput(result, path, format); err != nil {
+			return fmt.Errorf("writing %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func writeOutput(result *transcript.Transcript, path string, format transcript.Format) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".transcript-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := transcript.Write(file, format, result, transcript.DefaultWriteOptions()); err != nil {
+		file.Close()
+		return err
+	}
+	// CreateTemp creates the file readable by the owner only
+	if err := file.Chmod(0o644); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// checkOutputs rejects inputs whose transcripts would be written to the same
+// path, e.g. a/x.wav and b/x.wav with an output directory or x.wav and x.mp3
+// next to each other. Paths are compared ignoring case like on Windows.
+func checkOutputs(files []string, outputDir string) error {
+	inputs := make(map[string]string, len(files))
+	for _, path := range files {
+		// The formats only change the extension, any of them tells the paths apart
+		out := strings.ToLower(filepath.Clean(OutputPath(path, outputDir, transcript.FormatText)))
+		if other, ok := inputs[out]; ok {
+			return fmt.Errorf("%s and %s would be transcribed to the same files, rename one of them", other, path)
+		}
+		inputs[out] = path
+	}
+	return nil
+}
+
+// expandInputs resolves the globs and directories of the inputs to audio files
+func expandInputs(inputs []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, input := range inputs {
+		matches, err := filepath.Glob(input)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", input, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s: no such file", input)
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil || entry.IsDir() {
+					return err
+				}
+				if ok, err := api.IsAudioFile(path); err == nil && ok {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return files, nil
+}
@@ -0,0 +1,26 @@
+package batch
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckOutputs(t *testing.T) {
+	tests := []struct {
+		files     []string
+		outputDir string
+		valid     bool
+	}{
+		{[]string{filepath.Join("a", "x.wav"), filepath.Join("b", "x.wav")}, "", true},
+		{[]string{filepath.Join("a", "x.wav"), filepath.Join("b", "x.wav")}, "out", false},
+		{[]string{filepath.Join("a", "x.wav"), filepath.Join("b", "X.WAV")}, "out", false},
+		{[]string{filepath.Join("a", "x.wav"), filepath.Join("a", "x.mp3")}, "", false},
+		{[]string{filepath.Join("a", "x.wav"), filepath.Join("a", "y.wav")}, "out", true},
+	}
+	for _, tt := range tests {
+		err := checkOutputs(tt.files, tt.outputDir)
+		if (err == nil) != tt.valid {
+			t.Errorf("checkOutputs(%v, %q) = %v, want valid %v", tt.files, tt.outputDir, err, tt.valid)
+		}
+	}
+}
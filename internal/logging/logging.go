@@ -0,0 +1,104 @@
+// Package logging configures the slog logger of the server and carries a
+// request scoped logger through the request context
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type contextKey struct{}
+
+// ParseLevel converts a level name (error, warning, info or debug) to a slog level
+func ParseLevel(name string) (slog.Level, error) {
+	switch name {
+	case "error":
+		return slog.LevelError, nil
+	case "warning":
+		return slog.LevelWarn, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q", name)
+}
+
+// New creates a logger writing text or json records at or above the level
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// WithContext returns a copy of ctx carrying the logger
+func WithContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Middleware assigns every request an ID, taken from the X-Request-ID header
+// when the client sent one, stores a logger tagged with it in the request
+// context and logs the completed request
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			start := time.Now()
+
+			id := req.Header.Get(echo.HeaderXRequestID)
+			if id == "" || len(id) > 128 {
+				id = newRequestID()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, id)
+
+			logger := slog.Default().With("request_id", id)
+			c.SetRequest(req.WithContext(WithContext(req.Context(), logger)))
+
+			// Let echo write the error response so its status is known
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			logger.Info("Request completed",
+				"method", req.Method,
+				"path", req.URL.Path,
+				"status", c.Response().Status,
+				"duration", time.Since(start),
+			)
+			return nil
+		}
+	}
+}
+
+func newRequestID() string {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(id)
+}
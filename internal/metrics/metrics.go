@@ -0,0 +1,240 @@
+// Package metrics exposes the server workload in the Prometheus text format
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Buckets for durations in seconds, from short requests to long transcriptions
+var DurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+type kind string
+
+const (
+	counterKind   kind = "counter"
+	gaugeKind     kind = "gauge"
+	histogramKind kind = "histogram"
+)
+
+// Registry holds metrics and writes them in the text exposition format
+type Registry struct {
+	mutex   sync.Mutex
+	metrics []*metric
+}
+
+// DefaultRegistry holds the metrics of the server
+var DefaultRegistry = &Registry{}
+
+type metric struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64
+
+	// Histograms only
+	counts []uint64
+	count  uint64
+}
+
+func (r *Registry) register(m *metric) *metric {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	m.series = make(map[string]*series)
+	if len(m.labels) == 0 {
+		// Expose metrics without labels before their first update
+		m.get(nil)
+	}
+	r.metrics = append(r.metrics, m)
+	return m
+}
+
+func (m *metric) get(labelValues []string) *series {
+	if len(labelValues) != len(m.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", m.name, len(m.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := m.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		if m.kind == histogramKind {
+			s.counts = make([]uint64, len(m.buckets))
+		}
+		m.series[key] = s
+	}
+	return s
+}
+
+// Counter is a monotonically increasing value
+type Counter struct{ m *metric }
+
+// NewCounter registers a counter in the default registry
+func NewCounter(name string, help string, labels ...string) *Counter {
+	return &Counter{DefaultRegistry.register(&metric{name: name, help: help, kind: counterKind, labels: labels})}
+}
+
+func (c *Counter) Add(value float64, labelValues ...string) {
+	c.m.mutex.Lock()
+	defer c.m.mutex.Unlock()
+	c.m.get(labelValues).value += value
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Gauge is a value which can go up and down
+type Gauge struct{ m *metric }
+
+// NewGauge registers a gauge in the default registry
+func NewGauge(name string, help string, labels ...string) *Gauge {
+	return &Gauge{DefaultRegistry.register(&metric{name: name, help: help, kind: gaugeKind, labels: labels})}
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.m.mutex.Lock()
+	defer g.m.mutex.Unlock()
+	g.m.get(labelValues).value = value
+}
+
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.m.mutex.Lock()
+	defer g.m.mutex.Unlock()
+	g.m.get(labelValues).value += value
+}
+
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+// Value returns the current value
+func (g *Gauge) Value(labelValues ...string) float64 {
+	g.m.mutex.Lock()
+	defer g.m.mutex.Unlock()
+	return g.m.get(labelValues).value
+}
+
+// Histogram counts observations in buckets
+type Histogram struct{ m *metric }
+
+// NewHistogram registers a histogram with the given upper bounds in the default registry
+func NewHistogram(name string, help string, buckets []float64, labels ...string) *Histogram {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Histogram{DefaultRegistry.register(&metric{name: name, help: help, kind: histogramKind, labels: labels, buckets: buckets})}
+}
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.m.mutex.Lock()
+	defer h.m.mutex.Unlock()
+
+	s := h.m.get(labelValues)
+	for i, bound := range h.m.buckets {
+		if value <= bound {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += value
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mutex.Lock()
+	metrics := append([]*metric(nil), r.metrics...)
+	r.mutex.Unlock()
+
+	var b strings.Builder
+	for _, m := range metrics {
+		m.write(&b)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (m *metric) write(b *strings.Builder) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", m.name, m.help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", m.name, m.kind)
+
+	keys := make([]string, 0, len(m.series))
+	for key := range m.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := m.series[key]
+		labels := formatLabels(m.labels, s.labelValues)
+
+		if m.kind != histogramKind {
+			fmt.Fprintf(b, "%s%s %s\n", m.name, wrapLabels(labels), formatValue(s.value))
+			continue
+		}
+
+		for i, bound := range m.buckets {
+			le := "le=\"" + formatValue(bound) + "\""
+			fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, wrapLabels(joinLabels(labels, le)), s.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", m.name, wrapLabels(joinLabels(labels, "le=\"+Inf\"")), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", m.name, wrapLabels(labels), formatValue(s.value))
+		fmt.Fprintf(b, "%s_count%s %d\n", m.name, wrapLabels(labels), s.count)
+	}
+}
+
+func formatLabels(names []string, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=\"" + labelEscaper.Replace(values[i]) + "\""
+	}
+	return strings.Join(pairs, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func joinLabels(labels string, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
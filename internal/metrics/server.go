@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+var (
+	RequestsTotal = NewCounter("whisper_http_requests_total",
+		"HTTP requests by route and status.", "method", "route", "status")
+	RequestDuration = NewHistogram("whisper_http_request_duration_seconds",
+		"HTTP request latency by route and status.", DurationBuckets, "method", "route", "status")
+
+	QueueDepth = NewGauge("whisper_queue_depth",
+		"Transcriptions waiting for the Whisper context.")
+	QueueWait = NewHistogram("whisper_queue_wait_seconds",
+		"Time transcriptions waited for the Whisper context.", DurationBuckets)
+
+	AudioSeconds = NewCounter("whisper_audio_seconds_total",
+		"Seconds of audio transcribed.")
+	ProcessingDuration = NewHistogram("whisper_processing_duration_seconds",
+		"Time spent decoding and transcribing audio.", DurationBuckets)
+	RealTimeFactor = NewHistogram("whisper_real_time_factor",
+		"Processing time divided by audio duration, lower is faster.",
+		[]float64{0.01, 0.025, 0.05, 0.1, 0.2, 0.3, 0.5, 0.75, 1, 1.5, 2, 5})
+	LastRealTimeFactor = NewGauge("whisper_last_real_time_factor",
+		"Real-time factor of the most recent transcription.")
+	FallbackDecodings = NewCounter("whisper_fallback_decodings_total",
+		"Windows decoded again because they failed the quality thresholds.")
+
+	ModelLoadSeconds = NewGauge("whisper_model_load_seconds",
+		"Time it took to load the model.", "model")
+	DownloadBytes = NewCounter("whisper_download_bytes_total",
+		"Bytes downloaded for models and the Whisper library.")
+)
+
+// ObserveTranscription records the audio duration and real-time factor of a transcription
+func ObserveTranscription(audio time.Duration, processing time.Duration) {
+	ProcessingDuration.Observe(processing.Seconds())
+	if audio <= 0 {
+		return
+	}
+
+	AudioSeconds.Add(audio.Seconds())
+	rtf := processing.Seconds() / audio.Seconds()
+	RealTimeFactor.Observe(rtf)
+	LastRealTimeFactor.Set(rtf)
+}
+
+// Middleware counts requests and measures their latency per route and status
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+
+			// Let echo write the error response so its status is known
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := strconv.Itoa(c.Response().Status)
+			method := c.Request().Method
+
+			RequestsTotal.Inc(method, route, status)
+			RequestDuration.Observe(time.Since(start).Seconds(), method, route, status)
+			return nil
+		}
+	}
+}
+
+// Handler serves the metrics of the default registry
+func Handler(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	c.Response().WriteHeader(http.StatusOK)
+	_, err := DefaultRegistry.WriteTo(c.Response())
+	return err
+}
@@ -0,0 +1,200 @@
+// Package openapi holds the OpenAPI 3 specification of the HTTP API and the
+// page rendering it, and checks JSON documents against the schemas of the
+// specification
+package openapi
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// docsPage renders the specification without loading anything but
+// openapi.json, so it works on hosts without internet access
+//
+//go:embed docs.html
+var docsPage []byte
+
+// Spec returns the OpenAPI specification
+func Spec() []byte {
+	return spec
+}
+
+// DocsPage returns the HTML page rendering the specification
+func DocsPage() []byte {
+	return docsPage
+}
+
+// document is a parsed JSON value
+type document = map[string]any
+
+// load parses the specification
+func load() (document, error) {
+	var d document
+	if err := json.Unmarshal(spec, &d); err != nil {
+		return nil, fmt.Errorf("parsing openapi.json: %w", err)
+	}
+	return d, nil
+}
+
+// Validate checks a JSON document against a schema of the components, e.g.
+// "VerboseTranscription". Properties which the schema does not declare are
+// rejected, so a field added to a response without documenting it fails.
+func Validate(schema string, data []byte) error {
+	d, err := load()
+	if err != nil {
+		return err
+	}
+
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("parsing the document: %w", err)
+	}
+
+	return validate(d, document{"$ref": "#/components/schemas/" + schema}, value, "$")
+}
+
+// resolve follows the $ref of a schema
+func resolve(d document, schema document) (document, error) {
+	for {
+		ref, ok := schema["$ref"].(string)
+		if !ok {
+			return schema, nil
+		}
+
+		var node any = d
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			m, ok := node.(document)
+			if !ok {
+				return nil, fmt.Errorf("unresolved reference %s", ref)
+			}
+			if node, ok = m[part]; !ok {
+				return nil, fmt.Errorf("unresolved reference %s", ref)
+			}
+		}
+		if schema, ok = node.(document); !ok {
+			return nil, fmt.Errorf("reference %s is not a schema", ref)
+		}
+	}
+}
+
+// validate checks a value against the subset of JSON Schema the specification
+// uses: $ref, oneOf, type, nullable, enum, required, properties, items and the
+// date-time format
+func validate(d document, schema document, value any, path string) error {
+	schema, err := resolve(d, schema)
+	if err != nil {
+		return err
+	}
+
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		var errs []string
+		for _, option := range oneOf {
+			err := validate(d, option.(document), value, path)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("%s matches none of the schemas: %s", path, strings.Join(errs, "; "))
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		return fmt.Errorf("%s is null", path)
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !slices.Contains(enum, value) {
+		return fmt.Errorf("%s is %v, expected one of %v", path, value, enum)
+	}
+
+	switch schema["type"] {
+	case "object":
+		object, ok := value.(document)
+		if !ok {
+			return fmt.Errorf("%s is not an object", path)
+		}
+		return validateObject(d, schema, object, path)
+
+	case "array":
+		array, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s is not an array", path)
+		}
+		items, _ := schema["items"].(document)
+		for i, item := range array {
+			if err := validate(d, items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s is not a string", path)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s is not a date-time: %w", path, err)
+			}
+		}
+
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s is not a number", path)
+		}
+
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s is not an integer", path)
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("%s is not an integer", path)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s is not a boolean", path)
+		}
+	}
+	return nil
+}
+
+func validateObject(d document, schema document, object document, path string) error {
+	required, _ := schema["required"].([]any)
+	for _, name := range required {
+		if _, ok := object[name.(string)]; !ok {
+			return fmt.Errorf("%s.%s is missing", path, name)
+		}
+	}
+
+	properties, _ := schema["properties"].(document)
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		property, ok := properties[name].(document)
+		if !ok {
+			return fmt.Errorf("%s.%s is not documented", path, name)
+		}
+		if err := validate(d, property, object[name], path+"."+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package openapi
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+)
+
+func sampleTranscript() *transcript.Transcript {
+	return &transcript.Transcript{
+		Language:            "en",
+		LanguageProbability: 1,
+		Duration:            4 * time.Second,
+		Segments: []transcript.Segment{
+			{
+				ID: 0, Start: 0, End: 2 * time.Second, Text: " Hello there.",
+				Tokens: []transcript.Token{
+					{ID: 50364, Text: "[_BEG_]", Special: true},
+					{ID: 2425, Text: " Hello", End: time.Second, Probability: 0.9},
+					{ID: 456, Text: " there.", Start: time.Second, End: 2 * time.Second, Probability: 0.8},
+				},
+			},
+			{ID: 1, Start: 2 * time.Second, End: 4 * time.Second, Text: " How are you?", Fallback: 1, LowConfidence: true},
+		},
+	}
+}
+
+// walk calls f for every schema object of the specification
+func walk(node any, f func(document)) {
+	switch v := node.(type) {
+	case document:
+		f(v)
+		for _, child := range v {
+			walk(child, f)
+		}
+	case []any:
+		for _, child := range v {
+			walk(child, f)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	d, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	walk(d, func(node document) {
+		if _, ok := node["$ref"]; ok {
+			if _, err := resolve(d, node); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+}
+
+func TestDocsPageOffline(t *testing.T) {
+	external := regexp.MustCompile(`(src|href)\s*=\s*["']?(https?:)?//`)
+	if m := external.Find(DocsPage()); m != nil {
+		t.Errorf("docs page loads an external resource: %s", m)
+	}
+	if !bytes.Contains(DocsPage(), []byte(`fetch("openapi.json")`)) {
+		t.Error("docs page does not load openapi.json")
+	}
+}
+
+func TestResponseFormats(t *testing.T) {
+	d, err := load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request, err := resolve(d, document{"$ref": "#/components/schemas/TranscriptionRequest"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var documented []string
+	for _, f := range request["properties"].(document)["response_format"].(document)["enum"].([]any) {
+		documented = append(documented, f.(string))
+	}
+
+	var registered []string
+	for _, f := range transcript.Formats {
+		registered = append(registered, string(f))
+	}
+	slices.Sort(documented)
+	slices.Sort(registered)
+	if !slices.Equal(documented, registered) {
+		t.Errorf("response_format documents %v, the registered formats are %v", documented, registered)
+	}
+
+	content := d["paths"].(document)["/v1/audio/transcriptions"].(document)["post"].(document)["responses"].(document)["200"].(document)["content"].(document)
+	for _, f := range transcript.Formats {
+		contentType, _, err := mime.ParseMediaType(f.ContentType())
+		if err != nil {
+			t.Fatalf("content type of %s: %v", f, err)
+		}
+		if _, ok := content[contentType]; !ok {
+			t.Errorf("content type %s of %s is not documented", contentType, f)
+		}
+	}
+}
+
+func TestTranscriptSchemas(t *testing.T) {
+	tests := []struct {
+		format transcript.Format
+		schema string
+	}{
+		{transcript.FormatJSON, "Transcription"},
+		{transcript.FormatVerboseJSON, "VerboseTranscription"},
+	}
+
+	translated := sampleTranscript()
+	translated.Task = "translate"
+	translated.SourceLanguage = "de"
+	translated.Segments[1].SourceText = " Wie geht es dir?"
+
+	for _, tr := range []*transcript.Transcript{sampleTranscript(), translated} {
+		for _, tt := range tests {
+			var b bytes.Buffer
+			if err := transcript.Write(&b, tt.format, tr, transcript.DefaultWriteOptions()); err != nil {
+				t.Fatal(err)
+			}
+			if err := Validate(tt.schema, b.Bytes()); err != nil {
+				t.Errorf("%s does not match %s: %v\n%s", tt.format, tt.schema, err, b.Bytes())
+			}
+		}
+
+		var b bytes.Buffer
+		if err := transcript.Write(&b, transcript.FormatJSONL, tr, transcript.DefaultWriteOptions()); err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(&b)
+		for scanner.Scan() {
+			if err := Validate("Segment", scanner.Bytes()); err != nil {
+				t.Errorf("jsonl line does not match Segment: %v\n%s", err, scanner.Bytes())
+			}
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		schema string
+		data   string
+		valid  bool
+	}{
+		{"Error", `{"error": "invalid language"}`, true},
+		{"Error", `{"message": "invalid language"}`, false},
+		{"Error", `{"error": 1}`, false},
+		{"Health", `{"status": "ok"}`, true},
+		{"Health", `{"status": "fine"}`, false},
+		{"Transcription", `{"text": "Hello", "extra": true}`, false},
+		{"LanguageDetection", `{"language": "de", "probabilities": [{"language": "de", "probability": 0.9}], "candidates": ["en", "de"]}`, true},
+		{"LanguageDetection", `{"language": "de", "probabilities": [{"language": "de"}], "candidates": ["en", "de"]}`, false},
+	}
+	for _, tt := range tests {
+		err := Validate(tt.schema, []byte(tt.data))
+		if (err == nil) != tt.valid {
+			t.Errorf("Validate(%s, %s) = %v, want valid %v", tt.schema, tt.data, err, tt.valid)
+		}
+	}
+}
@@ -1,56 +1,181 @@
 package resources
 
 import (
-	_ "embed"
-	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/xzeldon/whisper-api-server/pkg/whisper"
 )
 
-//go:embed languageMap.json
-var languageMapData []byte // Embedded language map file as a byte slice
-
-// Arguments holds the parsed CLI arguments
-type Arguments struct {
-	Language  string
-	ModelPath string
-	Port      int
-}
+// Commands run by main
+const (
+	CommandServe      = "serve"
+	CommandTranscribe = "transcribe"
+	CommandWatch      = "watch"
+)
 
 // ParsedArguments holds the processed arguments
 type ParsedArguments struct {
-	Language  int32
-	ModelPath string
-	Port      int
+	Config
+	Language int32
+	Sources  Sources
+
+	// Languages compared by the language detection
+	DetectLanguages []int32
+
+	Download DownloadPolicy
+
+	Command    string
+	Transcribe TranscribeArgs
+	Watch      WatchArgs
+
+	// Set when the command already ran, e.g. config print, and main has
+	// nothing left to do
+	Done bool
 }
 
-// LanguageMap represents the mapping of languages to their hex codes
-type LanguageMap map[string]string
+// TranscribeArgs holds the arguments of the transcribe command
+type TranscribeArgs struct {
+	Inputs    []string
+	OutputDir string
+	Formats   []string
+	Force     bool
+}
 
-func processLanguageAndCode(language string) (int32, error) {
-    var languageMap LanguageMap
-    err := json.Unmarshal(languageMapData, &languageMap)
-    if err != nil {
-        return 0x6E65, fmt.Errorf("error parsing language map: %w", err)
-    }
+// WatchArgs holds the arguments of the watch command
+type WatchArgs struct {
+	Dir       string
+	OutputDir string
+	Formats   []string
+	DoneDir   string
+	FailedDir string
+	StateFile string
+	Interval  time.Duration
+	Settle    time.Duration
+}
 
-    hexCode, ok := languageMap[strings.ToLower(language)]
-    if !ok {
-        return 0x6E65, fmt.Errorf("unsupported language")
-    }
+// flagUsage holds the help text of the flags bound to the Config fields
+var flagUsage = map[string]string{
+	"language":                  "Language of the audio, a code or a name such as en or German, or auto to detect it at the cost of a decoding per detectLanguages entry (default auto)",
+	"modelPath":                 "Path to the model file (required)",
+	"host":                      "Address to start the server on",
+	"port":                      "Port to start the server on",
+	"socket":                    "Unix domain socket to listen on instead of host and port",
+	"tlsCert":                   "TLS certificate file (PEM), reloaded when it changes",
+	"tlsKey":                    "TLS private key file (PEM)",
+	"tlsSelfSigned":             "Serve HTTPS with a generated self-signed certificate (development only)",
+	"shutdownTimeout":           "Seconds to wait for running transcriptions on shutdown before they are cancelled",
+	"logLevel":                  "Log level: " + strings.Join(logLevels, ", "),
+	"logFormat":                 "Log format: " + strings.Join(logFormats, ", "),
+	"samplingStrategy":          "Sampling strategy: " + strings.Join(samplingStrategies, ", "),
+	"tmpDir":                    "Directory for uploaded files",
+	"tmpRetention":              "Seconds after which uploads left in tmpDir are removed, 0 disables the cleanup",
+	"maxUploadSize":             "Largest accepted upload in bytes, 0 for no limit",
+	"maxAudioDuration":          "Longest accepted audio in seconds, 0 for no limit",
+	"memoryDecodeLimit":         "Uploads up to this size in bytes are decoded from memory without a temp file, 0 disables it",
+	"gpu":                       "Name of the GPU adapter to use, empty for the default adapter",
+	"glossary":                  "Comma separated glossaries, defined in the configuration file, added to the prompt of every transcription",
+	"contexts":                  "Number of transcriptions run in parallel, each one holds a Whisper context in memory",
+	"fallback":                  "Decode again without the previous text the parts which fail the quality thresholds",
+	"compressionRatioThreshold": "Segments whose text compresses better than this are decoded again, a high ratio means repeated text",
+	"logprobThreshold":          "Segments whose average token log probability is lower than this are decoded again",
+	"filters":                   "Comma separated filters applied to every result: no_speech, hallucinations, duplicates, low_confidence",
+	"noSpeechThreshold":         "Segments whose estimated no-speech probability is higher than this are dropped by the no_speech filter",
+	"lowConfidenceThreshold":    "Segments whose average token probability is lower than this are flagged by the low_confidence filter",
+	"vad":                       "Transcribe only the speech found by voice activity detection: " + strings.Join(vadModes, ", "),
+	"chunkLength":               "Audio files longer than this many seconds are transcribed in overlapping chunks, which can be resumed, 0 disables it",
+	"chunkOverlap":              "Seconds two consecutive chunks overlap",
+	"translateURL":              "Base URL of a LibreTranslate compatible service, enables the target_language of requests",
+	"translateAPIKey":           "API key of the translation service",
+	"translateTimeout":          "Seconds a translation request may take",
+	"detectLanguages":           "Comma separated languages compared by the language detection, at most 16, the first one is used for audio without speech",
+	"whisperVersion":            "Whisper library release to use, installed into " + LibraryDir + "/<version>",
+	"modelMirror":               "Base URL the models are downloaded from (http(s):// or file://)",
+	"libraryMirror":             "Base URL the Whisper library releases are downloaded from (http(s):// or file://)",
+	"localDir":                  "Local directory to install the model and Library.zip from, e.g. a USB drive",
+	"offline":                   "Never access the network to acquire the model or library",
+	"yes":                       "Download missing files without asking",
+	"no-download":               "Never download missing files, fail instead",
+}
+
+var flagShorthands = map[string]string{
+	"language":  "l",
+	"modelPath": "m",
+	"port":      "p",
+	"yes":       "y",
+}
+
+func newParsedArguments(cmd *cobra.Command, cfg Config) (*ParsedArguments, error) {
+	// A flag overrides the opposite setting from the file or the environment
+	if cmd.Flags().Changed("yes") && !cmd.Flags().Changed("no-download") {
+		cfg.NoDownload = false
+	}
+	if cmd.Flags().Changed("no-download") && !cmd.Flags().Changed("yes") {
+		cfg.Yes = false
+	}
 
-    fmt.Printf("Hex Code Found: %s\n", hexCode)
+	download := DownloadAsk
+	switch {
+	case cfg.Yes && cfg.NoDownload:
+		return nil, fmt.Errorf("yes and noDownload cannot both be enabled")
+	case cfg.Yes:
+		download = DownloadAlways
+	case cfg.NoDownload:
+		download = DownloadNever
+	}
 
-    languageCode, err := strconv.ParseInt(hexCode, 0, 32)
-    if err != nil {
-        return 0x6E65, fmt.Errorf("error converting hex code: %w", err)
-    }
+	languageCode, err := whisper.ParseLanguage(cfg.Language)
+	if err != nil {
+		return nil, fmt.Errorf("invalid language %q: %w", cfg.Language, err)
+	}
 
-    return int32(languageCode), nil
+	var detectLanguages []int32
+	for _, code := range strings.Split(cfg.DetectLanguages, ",") {
+		if code = strings.TrimSpace(code); code == "" {
+			continue
+		}
+		language, err := whisper.ParseLanguage(code)
+		if err == nil && language == int32(whisper.Auto) {
+			err = fmt.Errorf("auto is not a language")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid detectLanguages %q: %w", code, err)
+		}
+		detectLanguages = append(detectLanguages, language)
+	}
+	if len(detectLanguages) == 0 {
+		return nil, fmt.Errorf("detectLanguages lists no language")
+	}
+
+	return &ParsedArguments{
+		Config:   cfg,
+		Language: languageCode,
+
+		DetectLanguages: detectLanguages,
+
+		Sources: Sources{
+			ModelBaseURL:   cfg.ModelMirror,
+			LibraryBaseURL: cfg.LibraryMirror,
+			LocalDir:       cfg.LocalDir,
+			Offline:        cfg.Offline,
+		},
+		Download: download,
+	}, nil
+}
+
+// printLanguages writes the language registry as a table
+func printLanguages(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "CODE\tNAME\tNATIVE NAME")
+	for _, l := range whisper.Languages() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", l.Code(), l.Name, l.NativeName)
+	}
+	return tw.Flush()
 }
 
 func ApplyExitOnHelp(c *cobra.Command, exitCode int) {
@@ -62,44 +187,142 @@ func ApplyExitOnHelp(c *cobra.Command, exitCode int) {
 }
 
 func ParseFlags() (*ParsedArguments, error) {
-    args := &Arguments{}
-
-    var parsedArgs *ParsedArguments
-
-    cobra.MousetrapHelpText = ""
-
-    rootCmd := &cobra.Command{
-        Use:   "whisper",
-        Short: "Audio transcription using the OpenAI Whisper models",
-        RunE: func(cmd *cobra.Command, _ []string) error {
-            // Process language code with fallback
-            languageCode, err := processLanguageAndCode(args.Language)
-            if err != nil {
-                fmt.Println("Error setting language, defaulting to English")
-                // Default to English
-                languageCode = 0x6E65
-            }
-
-            parsedArgs = &ParsedArguments{
-                Language:  languageCode,
-                ModelPath: args.ModelPath,
-                Port:      args.Port,
-            }
-            return nil
-        },
-    }
-
-    rootCmd.Flags().StringVarP(&args.Language, "language", "l", "", "Language to be processed")
-    rootCmd.Flags().StringVarP(&args.ModelPath, "modelPath", "m", "ggml-medium.bin", "Path to the model file (required)")
-    rootCmd.Flags().IntVarP(&args.Port, "port", "p", 3000, "Port to start the server on")
+	flagConfig := DefaultConfig()
+	var configPath string
+
+	var parsedArgs *ParsedArguments
+
+	cobra.MousetrapHelpText = ""
+
+	rootCmd := &cobra.Command{
+		Use:   "whisper",
+		Short: "Audio transcription using the OpenAI Whisper models",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := LoadConfig(cmd, configPath, &flagConfig)
+			if err != nil {
+				return err
+			}
+
+			parsedArgs, err = newParsedArguments(cmd, cfg)
+			if err != nil {
+				return err
+			}
+			parsedArgs.Command = CommandServe
+			return nil
+		},
+	}
+
+	rootCmd.PersistentFlags().StringVarP(&configPath, "config", "c", "", "Path to the YAML configuration file (default "+defaultConfigFile+", env "+envPrefix+"CONFIG)")
+	flagConfig.bindFlags(rootCmd.PersistentFlags(), flagUsage, flagShorthands)
+	rootCmd.MarkFlagsMutuallyExclusive("yes", "no-download")
+
+	configCmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration",
+	}
+	configCmd.AddCommand(&cobra.Command{
+		Use:   "print",
+		Short: "Print the effective configuration with secrets redacted",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			cfg, err := LoadConfig(cmd, configPath, &flagConfig)
+			if err != nil {
+				return err
+			}
+
+			if err := cfg.Redacted().Print(); err != nil {
+				return err
+			}
+			parsedArgs = &ParsedArguments{Done: true}
+			return nil
+		},
+	})
+	rootCmd.AddCommand(configCmd)
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "languages",
+		Short: "List the languages the multilingual models transcribe",
+		Long: "List the languages the multilingual models transcribe. The code, the English\n" +
+			"name or the native name is accepted wherever a language is expected.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			if err := printLanguages(os.Stdout); err != nil {
+				return err
+			}
+			parsedArgs = &ParsedArguments{Done: true}
+			return nil
+		},
+	})
+
+	var transcribeArgs TranscribeArgs
+	transcribeCmd := &cobra.Command{
+		Use:   "transcribe <file, directory or glob>...",
+		Short: "Transcribe local audio files without starting the server",
+		Long: "Transcribe local audio files without starting the server.\n" +
+			"Directories are searched recursively for audio files. Files whose transcripts\n" +
+			"are newer than the audio are skipped, unless --force is given.",
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, inputs []string) error {
+			cfg, err := LoadConfig(cmd, configPath, &flagConfig)
+			if err != nil {
+				return err
+			}
+
+			parsedArgs, err = newParsedArguments(cmd, cfg)
+			if err != nil {
+				return err
+			}
+			parsedArgs.Command = CommandTranscribe
+			parsedArgs.Transcribe = transcribeArgs
+			parsedArgs.Transcribe.Inputs = inputs
+			return nil
+		},
+	}
+	transcribeCmd.Flags().StringVarP(&transcribeArgs.OutputDir, "outputDir", "o", "", "Directory for the transcripts (default next to each input)")
+	transcribeCmd.Flags().StringSliceVarP(&transcribeArgs.Formats, "format", "f", []string{"txt"}, "Comma separated output formats: txt, json, verbose_json, srt, vtt, ass, ssa, ttml, jsonl, csv, markdown, html")
+	transcribeCmd.Flags().BoolVar(&transcribeArgs.Force, "force", false, "Transcribe files whose transcripts already exist")
+	rootCmd.AddCommand(transcribeCmd)
+
+	var watchArgs WatchArgs
+	watchCmd := &cobra.Command{
+		Use:   "watch <directory>",
+		Short: "Transcribe the audio files dropped into a directory",
+		Long: "Poll a directory, e.g. a network share, for new audio files. A file is transcribed\n" +
+			"once it stopped growing, then moved to the done or failed directory. Processed\n" +
+			"files are recorded in a state file, so a restart does not transcribe them again.",
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(cmd, configPath, &flagConfig)
+			if err != nil {
+				return err
+			}
+
+			parsedArgs, err = newParsedArguments(cmd, cfg)
+			if err != nil {
+				return err
+			}
+			parsedArgs.Command = CommandWatch
+			parsedArgs.Watch = watchArgs
+			parsedArgs.Watch.Dir = args[0]
+			return nil
+		},
+	}
+	watchCmd.Flags().StringVarP(&watchArgs.OutputDir, "outputDir", "o", "", "Directory for the transcripts (default <directory>/transcripts)")
+	watchCmd.Flags().StringSliceVarP(&watchArgs.Formats, "format", "f", []string{"txt"}, "Comma separated output formats: txt, json, verbose_json, srt, vtt, ass, ssa, ttml, jsonl, csv, markdown, html")
+	watchCmd.Flags().StringVar(&watchArgs.DoneDir, "doneDir", "", "Directory the transcribed files are moved to, on the same volume (default <directory>/done)")
+	watchCmd.Flags().StringVar(&watchArgs.FailedDir, "failedDir", "", "Directory the failed files are moved to, on the same volume (default <directory>/failed)")
+	watchCmd.Flags().StringVar(&watchArgs.StateFile, "stateFile", "", "File recording the processed files (default <directory>/.whisper-watch.json)")
+	watchCmd.Flags().DurationVar(&watchArgs.Interval, "interval", 5*time.Second, "Interval between two scans of the directory")
+	watchCmd.Flags().DurationVar(&watchArgs.Settle, "settle", 10*time.Second, "Time a file must stay unchanged before it is transcribed")
+	rootCmd.AddCommand(watchCmd)
 
 	ApplyExitOnHelp(rootCmd, 0)
 
-    err := rootCmd.Execute()
-    if err != nil {
-        return nil, err
-    }
+	err := rootCmd.Execute()
+	if err != nil {
+		return nil, err
+	}
 
-    return parsedArgs, nil
+	return parsedArgs, nil
 }
-
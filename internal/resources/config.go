@@ -0,0 +1,431 @@
+package resources
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Prefix of the environment variables overriding the configuration
+	envPrefix = "WHISPER_API_"
+
+	// Configuration file used when neither --config nor WHISPER_API_CONFIG is given
+	defaultConfigFile = "config.yaml"
+
+	redacted = "REDACTED"
+
+	// DefaultModelType is the model offered for download when --modelPath is not given
+	DefaultModelType = "ggml-medium.bin"
+)
+
+// Config holds every setting of the server. The values are merged in this
+// order, later sources taking precedence:
+//
+//  1. built-in defaults
+//  2. the YAML configuration file
+//  3. WHISPER_API_* environment variables
+//  4. command line flags
+//
+// The yaml tag names the key in the configuration file and, unless a flag tag
+// is given, the command line flag. The env tag names the environment variable
+// without the WHISPER_API_ prefix.
+type Config struct {
+	Language  string `yaml:"language" env:"LANGUAGE"`
+	ModelPath string `yaml:"modelPath" env:"MODEL_PATH"`
+	Host      string `yaml:"host" env:"HOST"`
+	Port      int    `yaml:"port" env:"PORT"`
+	Socket    string `yaml:"socket" env:"SOCKET"`
+
+	TLSCert       string `yaml:"tlsCert" env:"TLS_CERT"`
+	TLSKey        string `yaml:"tlsKey" env:"TLS_KEY"`
+	TLSSelfSigned bool   `yaml:"tlsSelfSigned" env:"TLS_SELF_SIGNED"`
+
+	ShutdownTimeout int `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+
+	LogLevel          string `yaml:"logLevel" env:"LOG_LEVEL"`
+	LogFormat         string `yaml:"logFormat" env:"LOG_FORMAT"`
+	SamplingStrategy  string `yaml:"samplingStrategy" env:"SAMPLING_STRATEGY"`
+	TmpDir            string `yaml:"tmpDir" env:"TMP_DIR"`
+	TmpRetention      int    `yaml:"tmpRetention" env:"TMP_RETENTION"`
+	MemoryDecodeLimit int    `yaml:"memoryDecodeLimit" env:"MEMORY_DECODE_LIMIT"`
+	MaxUploadSize     int    `yaml:"maxUploadSize" env:"MAX_UPLOAD_SIZE"`
+	MaxAudioDuration  int    `yaml:"maxAudioDuration" env:"MAX_AUDIO_DURATION"`
+	GPU               string `yaml:"gpu" env:"GPU"`
+	Contexts          int    `yaml:"contexts" env:"CONTEXTS"`
+
+	Fallback                  bool    `yaml:"fallback" env:"FALLBACK"`
+	CompressionRatioThreshold float64 `yaml:"compressionRatioThreshold" env:"COMPRESSION_RATIO_THRESHOLD"`
+	LogprobThreshold          float64 `yaml:"logprobThreshold" env:"LOGPROB_THRESHOLD"`
+
+	Filters                string  `yaml:"filters" env:"FILTERS"`
+	NoSpeechThreshold      float64 `yaml:"noSpeechThreshold" env:"NO_SPEECH_THRESHOLD"`
+	LowConfidenceThreshold float64 `yaml:"lowConfidenceThreshold" env:"LOW_CONFIDENCE_THRESHOLD"`
+
+	VAD string `yaml:"vad" env:"VAD"`
+
+	DetectLanguages string `yaml:"detectLanguages" env:"DETECT_LANGUAGES"`
+
+	TranslateURL     string `yaml:"translateURL" env:"TRANSLATE_URL" secret:"url"`
+	TranslateAPIKey  string `yaml:"translateAPIKey" env:"TRANSLATE_API_KEY" secret:"true"`
+	TranslateTimeout int    `yaml:"translateTimeout" env:"TRANSLATE_TIMEOUT"`
+
+	ChunkLength  int `yaml:"chunkLength" env:"CHUNK_LENGTH"`
+	ChunkOverlap int `yaml:"chunkOverlap" env:"CHUNK_OVERLAP"`
+
+	// Phrases removed by the hallucinations filter, only set in the configuration file
+	Hallucinations []string `yaml:"hallucinations"`
+
+	// Named lists of terms added to the prompt, only set in the configuration file
+	Glossaries map[string][]string `yaml:"glossaries"`
+	Glossary   string              `yaml:"glossary" env:"GLOSSARY"`
+
+	WhisperVersion string `yaml:"whisperVersion" env:"WHISPER_VERSION"`
+	ModelMirror    string `yaml:"modelMirror" env:"MODEL_MIRROR" secret:"url"`
+	LibraryMirror  string `yaml:"libraryMirror" env:"LIBRARY_MIRROR" secret:"url"`
+	LocalDir       string `yaml:"localDir" env:"LOCAL_DIR"`
+	Offline        bool   `yaml:"offline" env:"OFFLINE"`
+	Yes            bool   `yaml:"yes" env:"YES"`
+	NoDownload     bool   `yaml:"noDownload" env:"NO_DOWNLOAD" flag:"no-download"`
+}
+
+var (
+	logLevels          = []string{"error", "warning", "info", "debug"}
+	logFormats         = []string{"text", "json"}
+	samplingStrategies = []string{"greedy", "beamSearch"}
+	vadModes           = []string{"off", "on"}
+)
+
+// Phrases Whisper produces on silence, music or noise, learned from the
+// subtitles in its training data
+var defaultHallucinations = []string{
+	"Thanks for watching",
+	"Thank you for watching",
+	"Thank you very much for watching",
+	"Please subscribe to my channel",
+	"Don't forget to like and subscribe",
+	"Subtitles by the Amara.org community",
+	"Transcription by CastingWords",
+}
+
+// DefaultConfig returns the built-in defaults
+func DefaultConfig() Config {
+	return Config{
+		Language:          "auto",
+		ModelPath:         DefaultModelType,
+		Host:              "127.0.0.1",
+		Port:              3000,
+		ShutdownTimeout:   30,
+		LogLevel:          "debug",
+		LogFormat:         "text",
+		SamplingStrategy:  "beamSearch",
+		TmpDir:            "tmp",
+		TmpRetention:      3600,
+		MemoryDecodeLimit: 32 << 20,
+		MaxUploadSize:     512 << 20,
+		Contexts:          1,
+
+		Fallback:                  false,
+		CompressionRatioThreshold: 2.4,
+		LogprobThreshold:          -1.0,
+
+		NoSpeechThreshold:      0.6,
+		LowConfidenceThreshold: 0.5,
+		Hallucinations:         defaultHallucinations,
+
+		VAD: "off",
+
+		DetectLanguages: "en,zh,de,es,ru,fr",
+
+		TranslateTimeout: 60,
+
+		ChunkOverlap: 10,
+
+		WhisperVersion: DefaultWhisperVersion,
+		ModelMirror:    DefaultModelBaseURL,
+		LibraryMirror:  DefaultLibraryBaseURL,
+	}
+}
+
+// Validate checks the values which are restricted to a fixed set
+func (c *Config) Validate() error {
+	if !contains(logLevels, c.LogLevel) {
+		return fmt.Errorf("invalid logLevel %q, expected one of %s", c.LogLevel, strings.Join(logLevels, ", "))
+	}
+	if !contains(logFormats, c.LogFormat) {
+		return fmt.Errorf("invalid logFormat %q, expected one of %s", c.LogFormat, strings.Join(logFormats, ", "))
+	}
+	if !contains(samplingStrategies, c.SamplingStrategy) {
+		return fmt.Errorf("invalid samplingStrategy %q, expected one of %s", c.SamplingStrategy, strings.Join(samplingStrategies, ", "))
+	}
+	if !contains(vadModes, c.VAD) {
+		return fmt.Errorf("invalid vad %q, expected one of %s", c.VAD, strings.Join(vadModes, ", "))
+	}
+	if c.ChunkLength < 0 {
+		return fmt.Errorf("invalid chunkLength %d", c.ChunkLength)
+	}
+	if c.ChunkLength > 0 && (c.ChunkOverlap < 0 || c.ChunkOverlap*2 >= c.ChunkLength) {
+		return fmt.Errorf("invalid chunkOverlap %d, it must be shorter than half of chunkLength", c.ChunkOverlap)
+	}
+	if c.TranslateTimeout < 1 {
+		return fmt.Errorf("invalid translateTimeout %d, at least 1 second is required", c.TranslateTimeout)
+	}
+	if c.TranslateURL != "" {
+		if u, err := url.Parse(c.TranslateURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid translateURL %q, expected an http or https URL", redactURL(c.TranslateURL))
+		}
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("invalid port %d", c.Port)
+	}
+	if c.TmpRetention < 0 {
+		return fmt.Errorf("invalid tmpRetention %d", c.TmpRetention)
+	}
+	if c.MaxUploadSize < 0 {
+		return fmt.Errorf("invalid maxUploadSize %d", c.MaxUploadSize)
+	}
+	if c.MaxAudioDuration < 0 {
+		return fmt.Errorf("invalid maxAudioDuration %d", c.MaxAudioDuration)
+	}
+	if c.Contexts < 1 {
+		return fmt.Errorf("invalid contexts %d, at least 1 is required", c.Contexts)
+	}
+	if c.CompressionRatioThreshold <= 0 {
+		return fmt.Errorf("invalid compressionRatioThreshold %g", c.CompressionRatioThreshold)
+	}
+	if c.LogprobThreshold > 0 {
+		return fmt.Errorf("invalid logprobThreshold %g, log probabilities are not positive", c.LogprobThreshold)
+	}
+	if c.NoSpeechThreshold < 0 || c.NoSpeechThreshold > 1 {
+		return fmt.Errorf("invalid noSpeechThreshold %g, expected a probability between 0 and 1", c.NoSpeechThreshold)
+	}
+	if c.LowConfidenceThreshold < 0 || c.LowConfidenceThreshold > 1 {
+		return fmt.Errorf("invalid lowConfidenceThreshold %g, expected a probability between 0 and 1", c.LowConfidenceThreshold)
+	}
+	for _, name := range strings.Split(c.Glossary, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if _, ok := c.Glossaries[name]; !ok {
+			return fmt.Errorf("unknown glossary %q, define it under glossaries in the configuration file", name)
+		}
+	}
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid shutdownTimeout %d", c.ShutdownTimeout)
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return errors.New("tlsCert and tlsKey must be given together")
+	}
+	if c.TLSSelfSigned && c.TLSCert != "" {
+		return errors.New("tlsSelfSigned cannot be combined with tlsCert")
+	}
+	return nil
+}
+
+// Redacted returns a copy of the configuration which is safe to print
+func (c Config) Redacted() Config {
+	v := reflect.ValueOf(&c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		switch t.Field(i).Tag.Get("secret") {
+		case "true":
+			if !field.IsZero() {
+				field.SetString(redacted)
+			}
+		case "url":
+			field.SetString(redactURL(field.String()))
+		}
+	}
+
+	return c
+}
+
+// Print writes the configuration as YAML
+func (c Config) Print() error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return err
+	}
+	_, err := os.Stdout.Write(buf.Bytes())
+	return err
+}
+
+// bindFlags registers a command line flag for every configuration field
+func (c *Config) bindFlags(flags *pflag.FlagSet, usage map[string]string, shorthands map[string]string) {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name := flagName(t.Field(i))
+		help := usage[name]
+		if env := t.Field(i).Tag.Get("env"); env != "" {
+			help += " (env " + envPrefix + env + ")"
+		}
+
+		switch ptr := v.Field(i).Addr().Interface().(type) {
+		case *string:
+			flags.StringVarP(ptr, name, shorthands[name], *ptr, help)
+		case *int:
+			flags.IntVarP(ptr, name, shorthands[name], *ptr, help)
+		case *float64:
+			flags.Float64VarP(ptr, name, shorthands[name], *ptr, help)
+		case *bool:
+			flags.BoolVarP(ptr, name, shorthands[name], *ptr, help)
+		}
+	}
+}
+
+// LoadConfig merges the defaults, the configuration file, the environment and
+// the flags changed on the command line, which were bound to flagConfig
+func LoadConfig(cmd *cobra.Command, configPath string, flagConfig *Config) (Config, error) {
+	cfg := DefaultConfig()
+
+	explicit := configPath != ""
+	if !explicit {
+		configPath, explicit = os.LookupEnv(envPrefix + "CONFIG")
+	}
+	if configPath == "" {
+		configPath = defaultConfigFile
+	}
+
+	if err := cfg.loadFile(configPath, explicit); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return cfg, err
+	}
+
+	cfg.loadFlags(cmd.Flags(), flagConfig)
+
+	return cfg, cfg.Validate()
+}
+
+func (c *Config) loadFile(path string, required bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) && !required {
+			return nil
+		}
+		return fmt.Errorf("reading configuration file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parsing configuration file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		env := t.Field(i).Tag.Get("env")
+		if env == "" {
+			continue
+		}
+
+		value, ok := os.LookupEnv(envPrefix + env)
+		if !ok {
+			continue
+		}
+
+		if err := setField(v.Field(i), value); err != nil {
+			return fmt.Errorf("invalid value %q for %s: %w", value, envPrefix+env, err)
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) loadFlags(flags *pflag.FlagSet, flagConfig *Config) {
+	v := reflect.ValueOf(c).Elem()
+	fv := reflect.ValueOf(flagConfig).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		if flags.Changed(flagName(t.Field(i))) {
+			v.Field(i).Set(fv.Field(i))
+		}
+	}
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		if value == "" {
+			field.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Kind())
+	}
+	return nil
+}
+
+func flagName(field reflect.StructField) string {
+	if name := field.Tag.Get("flag"); name != "" {
+		return name
+	}
+	return field.Tag.Get("yaml")
+}
+
+// redactURL hides the password of credentials embedded in a URL
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return raw
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	} else {
+		u.User = url.User(redacted)
+	}
+	return u.String()
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
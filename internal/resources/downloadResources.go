@@ -1,25 +1,64 @@
 package resources
 
 import (
-	"archive/zip"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/schollz/progressbar/v3"
+	"github.com/xzeldon/whisper-api-server/internal/metrics"
 )
 
-func GetModel(modelType string) (string, error) {
-	fileURL := fmt.Sprintf("https://huggingface.co/ggerganov/whisper.cpp/resolve/main/%s", modelType)
+const (
+	downloadAttempts = 5
+	downloadBackoff  = 2 * time.Second
+)
+
+// httpClient is used for all downloads. Proxy settings are taken from the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+var httpClient = &http.Client{
+	Transport: newTransport(),
+}
+
+func newTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	return transport
+}
+
+// httpStatusError is returned when a download responds with an unexpected status
+type httpStatusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("downloading %s: %s", e.url, e.status)
+}
+
+// retryable reports whether the request may succeed if repeated
+func (e *httpStatusError) retryable() bool {
+	return e.code == http.StatusRequestedRangeNotSatisfiable ||
+		e.code == http.StatusTooManyRequests ||
+		e.code >= 500
+}
+
+func GetModel(modelType string, sources Sources) (string, error) {
 	filePath := modelType
 
 	isModelFileExists := IsFileExists(filePath)
 
 	if !isModelFileExists {
 		fmt.Println("Model not found.")
-		err := DownloadFile(fileURL, filePath)
+		err := sources.fetchModel(modelType, filePath)
 		if err != nil {
 			return "", err
 		}
@@ -30,106 +69,138 @@ func GetModel(modelType string) (string, error) {
 		return "", err
 	}
 
-	fmt.Printf("Model found: %s\n", absPath)
+	slog.Info("Model found", "path", absPath)
 	return filePath, nil
 }
 
+// DownloadFile downloads url into filepath. The data is written to a ".part"
+// file first, which is resumed with a Range request if a previous attempt was
+// interrupted, and only renamed to filepath once the download is complete.
 func DownloadFile(url string, filepath string) error {
-	out, err := os.Create(filepath)
+	partPath := filepath + ".part"
+
+	var err error
+	for attempt := 0; attempt < downloadAttempts; attempt++ {
+		if attempt > 0 {
+			delay := downloadBackoff << (attempt - 1)
+			slog.Warn("Download failed, retrying", "url", url, "error", err, "delay", delay)
+			time.Sleep(delay)
+		}
+
+		err = downloadPart(url, partPath)
+		if err == nil {
+			return os.Rename(partPath, filepath)
+		}
+
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && !statusErr.retryable() {
+			return err
+		}
+	}
+
+	return fmt.Errorf("download of %s failed after %d attempts: %w", url, downloadAttempts, err)
+}
+
+func downloadPart(url string, partPath string) error {
+	var offset int64
+	if info, err := os.Stat(partPath); err == nil {
+		offset = info.Size()
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return err
 	}
-	defer out.Close()
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
 
-	resp, err := http.Get(url)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	fileSize := resp.ContentLength
+	flags := os.O_CREATE | os.O_WRONLY
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The server ignored the Range header, start over
+		flags |= os.O_TRUNC
+		offset = 0
+	case http.StatusPartialContent:
+		flags |= os.O_APPEND
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The part file is already complete if its size matches the remote size
+		if resp.Header.Get("Content-Range") == fmt.Sprintf("bytes */%d", offset) {
+			return nil
+		}
+		if err := os.Remove(partPath); err != nil {
+			return err
+		}
+		return &httpStatusError{url: url, status: resp.Status, code: resp.StatusCode}
+	default:
+		return &httpStatusError{url: url, status: resp.Status, code: resp.StatusCode}
+	}
+
+	// Error pages are sometimes served with a success status
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		return &httpStatusError{url: url, status: "unexpected HTML response", code: resp.StatusCode}
+	}
+
+	out, err := os.OpenFile(partPath, flags, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	fileSize := int64(-1)
+	if resp.ContentLength >= 0 {
+		fileSize = offset + resp.ContentLength
+	}
 	bar := progressbar.DefaultBytes(
 		fileSize,
 		"Downloading",
 	)
+	bar.Set64(offset)
 
 	writer := io.MultiWriter(out, bar)
 
-	_, err = io.Copy(writer, resp.Body)
+	written, err := io.Copy(writer, resp.Body)
+	metrics.DownloadBytes.Add(float64(written))
 	if err != nil {
 		return err
 	}
 
+	if resp.ContentLength >= 0 && written != resp.ContentLength {
+		return io.ErrUnexpectedEOF
+	}
+
 	return nil
 }
 
-func GetWhisperDll(version string) (string, error) {
-	fileUrl := fmt.Sprintf("https://github.com/Const-me/Whisper/releases/download/%s/Library.zip", version)
-	fileToExtract := "Binary/Whisper.dll"
-
-	isWhisperDllExists := IsFileExists("Whisper.dll")
-
-	if !isWhisperDllExists {
-		fmt.Println("Whisper DLL not found.")
-		archivePath, err := os.CreateTemp("", "WhisperLibrary-*.zip")
-		if err != nil {
-			return "", err
-		}
-		defer archivePath.Close()
-
-		err = DownloadFile(fileUrl, archivePath.Name())
-		if err != nil {
-			return "", err
-		}
-
-		err = extractFile(archivePath.Name(), fileToExtract)
-		if err != nil {
-			return "", err
-		}
+// GetWhisperDll installs the given library version into its versioned
+// directory, downloading the release archive if necessary, and returns the
+// path of Whisper.dll
+func GetWhisperDll(version string, sources Sources) (string, error) {
+	if dllPath, ok := InstalledLibrary(version); ok {
+		return dllPath, nil
 	}
 
-	absPath, err := filepath.Abs("Whisper.dll")
+	archive, err := os.CreateTemp("", "WhisperLibrary-*.zip")
 	if err != nil {
 		return "", err
 	}
+	// The download replaces this file, which Windows refuses while it is open
+	archive.Close()
+	defer os.Remove(archive.Name())
+	defer os.Remove(archive.Name() + ".part")
 
-	fmt.Printf("Library found: %s\n", absPath)
-	return "Whisper.dll", nil
-}
-
-func extractFile(archivePath string, fileToExtract string) error {
-	reader, err := zip.OpenReader(archivePath)
+	err = sources.fetchLibrary(version, archive.Name())
 	if err != nil {
-		return err
-	}
-	defer reader.Close()
-
-	for _, file := range reader.File {
-		if file.Name == fileToExtract {
-			targetPath := filepath.Base(fileToExtract)
-
-			writer, err := os.Create(targetPath)
-			if err != nil {
-				return err
-			}
-			defer writer.Close()
-
-			src, err := file.Open()
-			if err != nil {
-				return err
-			}
-			defer src.Close()
-
-			_, err = io.Copy(writer, src)
-			if err != nil {
-				return err
-			}
-
-			return nil
-		}
+		return "", err
 	}
 
-	return fmt.Errorf("File not found in the archive")
+	return installLibrary(archive.Name(), version)
 }
 
 func IsFileExists(filename string) bool {
@@ -140,4 +211,4 @@ func IsFileExists(filename string) bool {
 		}
 	}
 	return true
-}
\ No newline at end of file
+}
@@ -0,0 +1,227 @@
+package resources
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// LibraryDir holds one sub-directory per installed library version
+	LibraryDir = "lib"
+
+	// DefaultWhisperVersion is the library release used unless --whisperVersion is given
+	DefaultWhisperVersion = "1.12.0"
+
+	// Location of the DLL inside the release archive and the version directory
+	libraryDllPath = "Binary/Whisper.dll"
+
+	// Written last, a version directory without it is an incomplete installation
+	libraryManifest = "installed.json"
+
+	// Whisper.dll next to the executable, as installed by older releases
+	legacyDllName = "Whisper.dll"
+
+	maxArchiveEntries   = 1000
+	maxArchiveEntrySize = 512 << 20
+	maxArchiveTotalSize = 1 << 30
+)
+
+// libraryInstall is the manifest recorded for an installed library version
+type libraryInstall struct {
+	Version     string    `json:"version"`
+	InstalledAt time.Time `json:"installedAt"`
+	Files       []string  `json:"files"`
+}
+
+// LibraryVersionDir returns the directory the given library version is installed into
+func LibraryVersionDir(version string) string {
+	return filepath.Join(LibraryDir, version)
+}
+
+// InstalledLibrary returns the path of Whisper.dll if the version is completely
+// installed: the manifest is written and Whisper.dll and every file it lists
+// are present
+func InstalledLibrary(version string) (string, bool) {
+	dir := LibraryVersionDir(version)
+
+	data, err := os.ReadFile(filepath.Join(dir, libraryManifest))
+	if err != nil {
+		return "", false
+	}
+
+	var manifest libraryInstall
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.Version != version {
+		return "", false
+	}
+
+	dllPath := filepath.Join(dir, filepath.FromSlash(libraryDllPath))
+	if !isRegularFile(dllPath) {
+		return "", false
+	}
+	for _, name := range manifest.Files {
+		name, err := sanitizeArchivePath(name)
+		if err != nil || !isRegularFile(filepath.Join(dir, filepath.FromSlash(name))) {
+			return "", false
+		}
+	}
+
+	return dllPath, true
+}
+
+func isRegularFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// installLibrary extracts the release archive into the versioned library
+// directory. The archive is extracted into a staging directory first, which is
+// renamed once all files are written, so an interrupted installation is never used.
+func installLibrary(archivePath string, version string) (string, error) {
+	if version == "" || version != filepath.Base(version) || version == "." || version == ".." {
+		return "", fmt.Errorf("invalid library version %q", version)
+	}
+
+	if err := os.MkdirAll(LibraryDir, 0755); err != nil {
+		return "", err
+	}
+
+	staging, err := os.MkdirTemp(LibraryDir, "."+version+"-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(staging)
+
+	files, err := extractArchive(archivePath, staging)
+	if err != nil {
+		return "", err
+	}
+
+	if !isRegularFile(filepath.Join(staging, filepath.FromSlash(libraryDllPath))) {
+		return "", fmt.Errorf("%s not found in the archive", libraryDllPath)
+	}
+
+	manifest, err := json.MarshalIndent(libraryInstall{
+		Version:     version,
+		InstalledAt: time.Now().UTC(),
+		Files:       files,
+	}, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(staging, libraryManifest), manifest, 0644); err != nil {
+		return "", err
+	}
+
+	// Replace a previous incomplete installation
+	target := LibraryVersionDir(version)
+	if err := os.RemoveAll(target); err != nil {
+		return "", err
+	}
+	if err := os.Rename(staging, target); err != nil {
+		return "", err
+	}
+
+	dllPath := filepath.Join(target, filepath.FromSlash(libraryDllPath))
+	slog.Info("Whisper library installed", "version", version, "path", target)
+	return dllPath, nil
+}
+
+// extractArchive extracts every file of the zip archive into dir. Entries
+// escaping dir, links and archives exceeding the size limits are rejected.
+func extractArchive(archivePath string, dir string) ([]string, error) {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	if len(reader.File) > maxArchiveEntries {
+		return nil, fmt.Errorf("archive has too many entries: %d", len(reader.File))
+	}
+
+	var files []string
+	var total int64
+
+	for _, file := range reader.File {
+		name, err := sanitizeArchivePath(file.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if !file.Mode().IsRegular() {
+			return nil, fmt.Errorf("archive entry %s is not a regular file", file.Name)
+		}
+		if file.UncompressedSize64 > maxArchiveEntrySize {
+			return nil, fmt.Errorf("archive entry %s is too large", file.Name)
+		}
+
+		targetPath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return nil, err
+		}
+
+		written, err := extractArchiveFile(file, targetPath)
+		if err != nil {
+			return nil, err
+		}
+
+		total += written
+		if total > maxArchiveTotalSize {
+			return nil, fmt.Errorf("archive exceeds %d bytes when extracted", maxArchiveTotalSize)
+		}
+
+		files = append(files, name)
+	}
+
+	return files, nil
+}
+
+func extractArchiveFile(file *zip.File, targetPath string) (int64, error) {
+	src, err := file.Open()
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(targetPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer dst.Close()
+
+	// Do not trust the size recorded in the header
+	written, err := io.Copy(dst, io.LimitReader(src, maxArchiveEntrySize+1))
+	if err != nil {
+		return written, err
+	}
+	if written > maxArchiveEntrySize {
+		return written, fmt.Errorf("archive entry %s is too large", file.Name)
+	}
+
+	return written, dst.Close()
+}
+
+// sanitizeArchivePath returns the cleaned slash-separated path of an archive
+// entry, or an error if it is absolute or escapes the extraction directory
+func sanitizeArchivePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, `\`, "/")
+	cleaned := path.Clean(name)
+
+	if cleaned == "." || path.IsAbs(cleaned) || filepath.VolumeName(cleaned) != "" ||
+		cleaned == ".." || strings.HasPrefix(cleaned, "../") || strings.Contains(cleaned, ":") {
+		return "", fmt.Errorf("illegal path in archive: %s", name)
+	}
+
+	return cleaned, nil
+}
@@ -0,0 +1,142 @@
+package resources
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSanitizeArchivePath(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  string
+		valid bool
+	}{
+		{"Binary/Whisper.dll", "Binary/Whisper.dll", true},
+		{"./Binary//Whisper.dll", "Binary/Whisper.dll", true},
+		{`Binary\Whisper.dll`, "Binary/Whisper.dll", true},
+		{"Binary/../Whisper.dll", "Whisper.dll", true},
+		{"..readme.txt", "..readme.txt", true},
+		{"../Whisper.dll", "", false},
+		{"Binary/../../Whisper.dll", "", false},
+		{`..\..\Windows\System32\evil.dll`, "", false},
+		{"/etc/passwd", "", false},
+		{`\Windows\evil.dll`, "", false},
+		{`C:\Windows\evil.dll`, "", false},
+		{"C:evil.dll", "", false},
+		{"..", "", false},
+		{".", "", false},
+		{"Binary/..", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := sanitizeArchivePath(tt.name)
+		if (err == nil) != tt.valid || got != tt.want {
+			t.Errorf("sanitizeArchivePath(%q) = %q, %v, want %q, valid %v", tt.name, got, err, tt.want, tt.valid)
+		}
+	}
+}
+
+// writeArchive writes a zip archive with an entry per name
+func writeArchive(t *testing.T, names ...string) string {
+	t.Helper()
+
+	archivePath := filepath.Join(t.TempDir(), "library.zip")
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	archive := zip.NewWriter(file)
+	for _, name := range names {
+		w, err := archive.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+// chdirTemp runs the test in an empty working directory, LibraryDir is relative
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+func TestInstallLibrary(t *testing.T) {
+	chdirTemp(t)
+	archive := writeArchive(t, "Binary/Whisper.dll", "Binary/Readme.txt")
+
+	dllPath, err := installLibrary(archive, "1.12.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if installed, ok := InstalledLibrary("1.12.0"); !ok || installed != dllPath {
+		t.Fatalf("InstalledLibrary = %q, %v, want %q", installed, ok, dllPath)
+	}
+
+	// A file of the manifest is missing
+	if err := os.Remove(filepath.Join(LibraryVersionDir("1.12.0"), "Binary", "Readme.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := InstalledLibrary("1.12.0"); ok {
+		t.Error("installation with a missing file is reported as installed")
+	}
+
+	// Installing again replaces the incomplete installation
+	if _, err := installLibrary(archive, "1.12.0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := InstalledLibrary("1.12.0"); !ok {
+		t.Error("reinstalled library is not reported as installed")
+	}
+}
+
+func TestInstallLibraryFailed(t *testing.T) {
+	dir := chdirTemp(t)
+
+	tests := []struct {
+		name    string
+		entries []string
+	}{
+		{"no dll", []string{"Binary/Readme.txt"}},
+		{"zip slip", []string{"Binary/Whisper.dll", "../evil.dll"}},
+		{"absolute", []string{"Binary/Whisper.dll", "/evil.dll"}},
+	}
+	for _, tt := range tests {
+		if _, err := installLibrary(writeArchive(t, tt.entries...), "1.12.0"); err == nil {
+			t.Errorf("%s: installation succeeded", tt.name)
+		}
+		if _, err := os.Stat(LibraryVersionDir("1.12.0")); !os.IsNotExist(err) {
+			t.Errorf("%s: failed installation left the version directory: %v", tt.name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "evil.dll")); !os.IsNotExist(err) {
+			t.Errorf("%s: archive entry was written outside the library directory: %v", tt.name, err)
+		}
+	}
+
+	// Only the empty library directory is left, no staging directory
+	entries, err := os.ReadDir(LibraryDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("library directory holds %d entries after failed installations", len(entries))
+	}
+}
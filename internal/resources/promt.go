@@ -2,12 +2,55 @@ package resources
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/mattn/go-isatty"
 )
 
+// DownloadPolicy decides what happens when a required file is missing
+type DownloadPolicy int
+
+const (
+	// Ask the user, or refuse if stdin is not a terminal
+	DownloadAsk DownloadPolicy = iota
+	// Download without asking (--yes)
+	DownloadAlways
+	// Never download (--no-download)
+	DownloadNever
+)
+
+// ConfirmDownload asks the question according to the policy. It never blocks
+// on stdin when the process is not attached to a terminal, e.g. when running
+// as a Windows service or under a supervisor.
+func ConfirmDownload(question string, policy DownloadPolicy) bool {
+	switch policy {
+	case DownloadAlways:
+		fmt.Printf("%s yes (--yes)\n", question)
+		return true
+	case DownloadNever:
+		fmt.Printf("%s no (--no-download)\n", question)
+		return false
+	}
+
+	if !IsInteractive() {
+		fmt.Printf("%s no (stdin is not a terminal, use --yes to download automatically)\n", question)
+		return false
+	}
+
+	return PromptUser(question)
+}
+
+// IsInteractive reports whether stdin is a terminal the user can answer prompts on
+func IsInteractive() bool {
+	fd := os.Stdin.Fd()
+	return isatty.IsTerminal(fd) || isatty.IsCygwinTerminal(fd)
+}
+
 // PromptUser prompts the user with a question and returns true if they agree
 func PromptUser(question string) bool {
 	fmt.Printf("%s (y/n): ", question)
@@ -21,47 +64,75 @@ func PromptUser(question string) bool {
 	return response == "y" || response == "yes"
 }
 
-// HandleWhisperDll checks if Whisper.dll exists or prompts the user to download it
-func HandleWhisperDll(version string) (string, error) {
-	if IsFileExists("Whisper.dll") {
-		absPath, err := filepath.Abs("Whisper.dll")
-		if err != nil {
-			return "", err
+// HandleWhisperDll checks if the Whisper library version is installed or prompts the user to download it
+func HandleWhisperDll(version string, sources Sources, policy DownloadPolicy) (string, error) {
+	if dllPath, ok := InstalledLibrary(version); ok {
+		return libraryFound(dllPath)
+	}
+
+	// Whisper.dll next to the executable is used for the default version only,
+	// its version is unknown
+	if version == DefaultWhisperVersion && IsFileExists(legacyDllName) {
+		return libraryFound(legacyDllName)
+	}
+
+	fmt.Printf("Whisper library %s not found.\n", version)
+	if sources.Offline {
+		path, err := GetWhisperDll(version, sources)
+		if errors.Is(err, errOffline) {
+			sources.printOfflineHelp("Library.zip", DefaultSources().LibraryURL(version))
+			return "", fmt.Errorf("whisper library %s not found in offline mode", version)
 		}
-		fmt.Printf("Library found: %s\n", absPath)
-		return "Whisper.dll", nil
+		return path, err
 	}
 
-	fmt.Println("Whisper DLL not found.")
-	if PromptUser("Do you want to download Whisper.dll automatically?") {
-		path, err := GetWhisperDll(version)
+	if ConfirmDownload(fmt.Sprintf("Do you want to download Whisper library %s automatically?", version), policy) {
+		path, err := GetWhisperDll(version, sources)
 		if err != nil {
 			return "", fmt.Errorf("failed to download Whisper.dll: %w", err)
 		}
 		return path, nil
 	}
 
-	fmt.Println("To use Whisper, download the DLL manually:")
-	fmt.Printf("URL: https://github.com/Const-me/Whisper/releases/download/%s/Library.zip\n", version)
-	fmt.Println("Extract 'Binary/Whisper.dll' from the archive and place it in the executable's directory.")
-	fmt.Println("You can manually specify path to .dll file using cli arguments, use --help to print available cli flags")
-	return "", fmt.Errorf("whisper.dll not found and user chose not to download")
+	fmt.Println("To use Whisper, download the library manually:")
+	fmt.Printf("URL: %s\n", sources.LibraryURL(version))
+	fmt.Println("Place Library.zip in the directory given by --localDir and start the server again to install it.")
+	fmt.Println("You can select another library version using --whisperVersion, use --help to print available cli flags")
+	return "", fmt.Errorf("whisper library %s not found and user chose not to download", version)
+}
+
+func libraryFound(dllPath string) (string, error) {
+	absPath, err := filepath.Abs(dllPath)
+	if err != nil {
+		return "", err
+	}
+	slog.Info("Library found", "path", absPath)
+	return dllPath, nil
 }
 
 // HandleDefaultModel checks if the default model exists or prompts the user to download it
-func HandleDefaultModel(modelType string) (string, error) {
+func HandleDefaultModel(modelType string, sources Sources, policy DownloadPolicy) (string, error) {
 	if IsFileExists(modelType) {
 		absPath, err := filepath.Abs(modelType)
 		if err != nil {
 			return "", err
 		}
-		fmt.Printf("Model found: %s\n", absPath)
+		slog.Info("Model found", "path", absPath)
 		return modelType, nil
 	}
 
 	fmt.Println("Default model not found.")
-	if PromptUser("Do you want to download the default model (ggml-medium.bin) automatically?") {
-		path, err := GetModel(modelType)
+	if sources.Offline {
+		path, err := GetModel(modelType, sources)
+		if errors.Is(err, errOffline) {
+			sources.printOfflineHelp(modelType, DefaultSources().ModelURL(modelType))
+			return "", fmt.Errorf("default model not found in offline mode")
+		}
+		return path, err
+	}
+
+	if ConfirmDownload(fmt.Sprintf("Do you want to download the default model (%s) automatically?", modelType), policy) {
+		path, err := GetModel(modelType, sources)
 		if err != nil {
 			return "", fmt.Errorf("failed to download the default model: %w", err)
 		}
@@ -69,8 +140,27 @@ func HandleDefaultModel(modelType string) (string, error) {
 	}
 
 	fmt.Println("To use Whisper, download the model manually:")
-	fmt.Println("URL: https://huggingface.co/ggerganov/whisper.cpp/tree/main")
+	fmt.Printf("URL: %s\n", sources.ModelURL(modelType))
 	fmt.Println("Place the model file in the executable's directory or specify its path using cli arguments.")
 	fmt.Println("You can manually specify path to model file using cli arguments, use --help to print available cli flags")
 	return "", fmt.Errorf("default model not found and user chose not to download")
 }
+
+// HandleModel checks the model given by --modelPath. Only the default model is
+// offered for download, a custom model path has to exist.
+func HandleModel(modelPath string, defaultModel string, sources Sources, policy DownloadPolicy) (string, error) {
+	if modelPath == defaultModel {
+		return HandleDefaultModel(defaultModel, sources, policy)
+	}
+
+	if !IsFileExists(modelPath) {
+		return "", fmt.Errorf("model file %s not found", modelPath)
+	}
+
+	absPath, err := filepath.Abs(modelPath)
+	if err != nil {
+		return "", err
+	}
+	slog.Info("Model found", "path", absPath)
+	return modelPath, nil
+}
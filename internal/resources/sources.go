@@ -0,0 +1,170 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/schollz/progressbar/v3"
+)
+
+const (
+	DefaultModelBaseURL   = "https://huggingface.co/ggerganov/whisper.cpp/resolve/main"
+	DefaultLibraryBaseURL = "https://github.com/Const-me/Whisper/releases/download"
+)
+
+// errOffline is returned when a file has to be fetched from the network in offline mode
+var errOffline = errors.New("offline mode is enabled, refusing to download")
+
+// Sources describes where the model files and the Whisper library are acquired from
+type Sources struct {
+	// Base URL of the model files, "<ModelBaseURL>/<model>" is downloaded.
+	// May be an http(s) URL of an internal mirror or a file:// URL
+	ModelBaseURL string
+
+	// Base URL of the library releases, "<LibraryBaseURL>/<version>/Library.zip" is downloaded
+	LibraryBaseURL string
+
+	// Local directory, e.g. a USB drive, searched for "<model>" and
+	// "<version>/Library.zip" or "Library.zip" before anything is downloaded
+	LocalDir string
+
+	// Never access the network
+	Offline bool
+}
+
+// DefaultSources returns the public Hugging Face and GitHub locations
+func DefaultSources() Sources {
+	return Sources{
+		ModelBaseURL:   DefaultModelBaseURL,
+		LibraryBaseURL: DefaultLibraryBaseURL,
+	}
+}
+
+// ModelURL returns the URL the given model file is downloaded from
+func (s Sources) ModelURL(modelType string) string {
+	return joinURL(s.ModelBaseURL, modelType)
+}
+
+// LibraryURL returns the URL the library archive of the given version is downloaded from
+func (s Sources) LibraryURL(version string) string {
+	return joinURL(s.LibraryBaseURL, version, "Library.zip")
+}
+
+// fetchModel copies or downloads the model file into filePath
+func (s Sources) fetchModel(modelType string, filePath string) error {
+	if s.LocalDir != "" {
+		localPath := filepath.Join(s.LocalDir, modelType)
+		if IsFileExists(localPath) {
+			return copyFile(localPath, filePath)
+		}
+	}
+
+	return s.fetch(s.ModelURL(modelType), filePath)
+}
+
+// fetchLibrary copies or downloads the library archive into archivePath
+func (s Sources) fetchLibrary(version string, archivePath string) error {
+	if s.LocalDir != "" {
+		for _, localPath := range []string{
+			filepath.Join(s.LocalDir, version, "Library.zip"),
+			filepath.Join(s.LocalDir, "Library.zip"),
+		} {
+			if IsFileExists(localPath) {
+				return copyFile(localPath, archivePath)
+			}
+		}
+	}
+
+	return s.fetch(s.LibraryURL(version), archivePath)
+}
+
+func (s Sources) fetch(fileURL string, filePath string) error {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme == "file" {
+		return copyFile(fileURLPath(u), filePath)
+	}
+
+	if s.Offline {
+		return fmt.Errorf("%w %s", errOffline, fileURL)
+	}
+
+	return DownloadFile(fileURL, filePath)
+}
+
+// printOfflineHelp explains how to provide a missing file without network access
+func (s Sources) printOfflineHelp(fileName string, remoteURL string) {
+	fmt.Println("Offline mode is enabled, nothing will be downloaded.")
+	fmt.Printf("Download %s on a machine with network access:\n", fileName)
+	fmt.Printf("URL: %s\n", remoteURL)
+	fmt.Println("Then either place it in the executable's directory, copy it into the directory given by --localDir,")
+	fmt.Println("or point --modelMirror/--libraryMirror to a file:// URL of the directory containing it.")
+}
+
+// copyFile copies src to dst. The data is written to a ".part" file first,
+// which is only renamed to dst once the copy is complete, so an interrupted
+// copy never leaves a truncated file behind.
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Copying %s\n", src)
+
+	partPath := dst + ".part"
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partPath)
+	defer out.Close()
+
+	bar := progressbar.DefaultBytes(
+		info.Size(),
+		"Copying",
+	)
+
+	if _, err = io.Copy(io.MultiWriter(out, bar), in); err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partPath, dst)
+}
+
+func joinURL(base string, elem ...string) string {
+	return strings.TrimRight(base, "/") + "/" + strings.Join(elem, "/")
+}
+
+// fileURLPath converts a file:// URL to a local path, including
+// drive letters (file:///C:/models) and UNC shares (file://server/share)
+func fileURLPath(u *url.URL) string {
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		if len(path) > 2 && path[0] == '/' && path[2] == ':' {
+			path = path[1:]
+		}
+		if u.Host != "" && u.Host != "localhost" {
+			path = "//" + u.Host + path
+		}
+	}
+	return filepath.FromSlash(path)
+}
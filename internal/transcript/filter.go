@@ -0,0 +1,121 @@
+package transcript
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Filter is a post-processing step applied to a transcript
+type Filter string
+
+const (
+	// FilterNoSpeech drops the segments which are likely not speech, see Segment.NoSpeechProb
+	FilterNoSpeech Filter = "no_speech"
+
+	// FilterDuplicates collapses consecutive segments with the same text into one
+	FilterDuplicates Filter = "duplicates"
+
+	// FilterHallucinations drops the segments consisting of a known hallucination
+	// phrase, e.g. "Thank you for watching" transcribed from silence
+	FilterHallucinations Filter = "hallucinations"
+
+	// FilterLowConfidence flags the segments whose tokens have a low probability
+	FilterLowConfidence Filter = "low_confidence"
+)
+
+// Filters lists the supported filters in the order they are applied
+var Filters = []Filter{FilterNoSpeech, FilterHallucinations, FilterDuplicates, FilterLowConfidence}
+
+// FilterNone disables every filter when given as the only filter name
+const FilterNone = "none"
+
+// ParseFilters converts filter names to filters, "none" returns no filters
+func ParseFilters(names []string) ([]Filter, error) {
+	filters := make([]Filter, 0, len(names))
+	for _, name := range names {
+		if name == FilterNone && len(names) == 1 {
+			return filters, nil
+		}
+
+		found := false
+		for _, f := range Filters {
+			if string(f) == name {
+				filters = append(filters, f)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unsupported filter %q", name)
+		}
+	}
+	return filters, nil
+}
+
+// FilterOptions holds the thresholds of the filters
+type FilterOptions struct {
+	// Segments with a higher no-speech probability are dropped
+	NoSpeechThreshold float64
+
+	// Segments whose tokens have a lower average probability are flagged
+	LowConfidenceThreshold float64
+
+	// Phrases the model produces on silence or noise, compared ignoring case,
+	// punctuation and spacing
+	Hallucinations []string
+}
+
+// Filter applies the filters to the transcript in the order of Filters and
+// returns the number of segments removed
+func (t *Transcript) Filter(filters []Filter, opts FilterOptions) int {
+	enabled := make(map[Filter]bool, len(filters))
+	for _, f := range filters {
+		enabled[f] = true
+	}
+
+	hallucinations := make(map[string]bool, len(opts.Hallucinations))
+	for _, phrase := range opts.Hallucinations {
+		hallucinations[normalize(phrase)] = true
+	}
+
+	count := len(t.Segments)
+	segments := make([]Segment, 0, count)
+
+	for _, seg := range t.Segments {
+		text := normalize(seg.Text)
+
+		if enabled[FilterNoSpeech] && seg.NoSpeechProb() > opts.NoSpeechThreshold {
+			continue
+		}
+		if enabled[FilterHallucinations] && hallucinations[text] {
+			continue
+		}
+		if enabled[FilterDuplicates] && len(segments) > 0 && text != "" {
+			if last := &segments[len(segments)-1]; normalize(last.Text) == text {
+				last.End = seg.End
+				continue
+			}
+		}
+		if enabled[FilterLowConfidence] {
+			seg.LowConfidence = seg.AvgProbability() < opts.LowConfidenceThreshold
+		}
+
+		segments = append(segments, seg)
+	}
+
+	for i := range segments {
+		segments[i].ID = i
+	}
+	t.Segments = segments
+
+	return count - len(segments)
+}
+
+// normalize lowercases the text and removes punctuation and redundant spaces
+func normalize(text string) string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsPunct(r)
+	})
+	return strings.Join(fields, " ")
+}
@@ -0,0 +1,321 @@
+package transcript
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Format is a response format of the transcription API and an output format
+// of the transcribe command
+type Format string
+
+const (
+	FormatJSON        Format = "json"
+	FormatText        Format = "text"
+	FormatSRT         Format = "srt"
+	FormatVTT         Format = "vtt"
+	FormatVerboseJSON Format = "verbose_json"
+	FormatASS         Format = "ass"
+	FormatSSA         Format = "ssa"
+	FormatTTML        Format = "ttml"
+	FormatJSONL       Format = "jsonl"
+	FormatCSV         Format = "csv"
+	FormatMarkdown    Format = "markdown"
+	FormatHTML        Format = "html"
+)
+
+// WriteOptions holds the settings of the formats which take any
+type WriteOptions struct {
+	// Cues of the subtitle formats
+	Subtitles SubtitleOptions
+
+	// Interval of the timestamps of the Markdown transcript
+	TimestampInterval time.Duration
+}
+
+// DefaultWriteOptions returns the defaults of every format
+func DefaultWriteOptions() WriteOptions {
+	return WriteOptions{
+		Subtitles:         DefaultSubtitleOptions(),
+		TimestampInterval: 30 * time.Second,
+	}
+}
+
+// Formatter writes transcripts in a format
+type Formatter struct {
+	// MIME type of the written transcripts
+	ContentType string
+
+	// File extension used when the format is written to disk
+	Extension string
+
+	Write func(w io.Writer, t *Transcript, opts WriteOptions) error
+}
+
+var formatters = make(map[Format]Formatter)
+
+// Formats lists the registered formats in the order of their registration
+var Formats []Format
+
+// Register adds a format, or replaces the formatter of a registered format
+func Register(f Format, formatter Formatter) {
+	if _, ok := formatters[f]; !ok {
+		Formats = append(Formats, f)
+	}
+	formatters[f] = formatter
+}
+
+func init() {
+	Register(FormatJSON, Formatter{ContentType: "application/json; charset=utf-8", Extension: ".json", Write: writeJSON})
+	Register(FormatText, Formatter{ContentType: "text/plain; charset=utf-8", Extension: ".txt", Write: writeText})
+	Register(FormatSRT, Formatter{ContentType: "application/x-subrip; charset=utf-8", Extension: ".srt", Write: writeSRT})
+	Register(FormatVTT, Formatter{ContentType: "text/vtt; charset=utf-8", Extension: ".vtt", Write: writeVTT})
+	Register(FormatVerboseJSON, Formatter{ContentType: "application/json; charset=utf-8", Extension: ".verbose.json", Write: writeVerboseJSON})
+	Register(FormatASS, Formatter{ContentType: "text/x-ssa; charset=utf-8", Extension: ".ass", Write: writeASS})
+	Register(FormatSSA, Formatter{ContentType: "text/x-ssa; charset=utf-8", Extension: ".ssa", Write: writeSSA})
+	Register(FormatTTML, Formatter{ContentType: "application/ttml+xml; charset=utf-8", Extension: ".ttml", Write: writeTTML})
+	Register(FormatJSONL, Formatter{ContentType: "application/jsonl; charset=utf-8", Extension: ".jsonl", Write: writeJSONL})
+	Register(FormatCSV, Formatter{ContentType: "text/csv; charset=utf-8", Extension: ".csv", Write: writeCSV})
+	Register(FormatMarkdown, Formatter{ContentType: "text/markdown; charset=utf-8", Extension: ".md", Write: writeMarkdown})
+	Register(FormatHTML, Formatter{ContentType: "text/html; charset=utf-8", Extension: ".html", Write: writeHTML})
+}
+
+// ParseFormat converts a response_format value to a Format, an empty value is json
+func ParseFormat(name string) (Format, error) {
+	if name == "" {
+		return FormatJSON, nil
+	}
+	if _, ok := formatters[Format(name)]; !ok {
+		return "", fmt.Errorf("unsupported response_format %q", name)
+	}
+	return Format(name), nil
+}
+
+// ContentType returns the MIME type of the format
+func (f Format) ContentType() string {
+	return formatters[f].ContentType
+}
+
+// Extension returns the file extension used when the format is written to disk
+func (f Format) Extension() string {
+	return formatters[f].Extension
+}
+
+// Response is the body of the json format
+type Response struct {
+	Text string `json:"text"`
+}
+
+// VerboseResponse is the body of the verbose_json format
+type VerboseResponse struct {
+	Task                string           `json:"task"`
+	Language            string           `json:"language"`
+	LanguageProbability float64          `json:"language_probability"`
+	SourceLanguage      string           `json:"source_language,omitempty"`
+	Duration            float64          `json:"duration"`
+	Text                string           `json:"text"`
+	Segments            []VerboseSegment `json:"segments"`
+}
+
+type VerboseSegment struct {
+	ID     int     `json:"id"`
+	Start  float64 `json:"start"`
+	End    float64 `json:"end"`
+	Text   string  `json:"text"`
+	Tokens []int32 `json:"tokens"`
+
+	// Always 0, the engine has no sampling temperature. Kept for clients of the
+	// OpenAI API, Fallback counts the decodings in its place.
+	Temperature float64 `json:"temperature"`
+
+	AvgLogprob       float64 `json:"avg_logprob"`
+	CompressionRatio float64 `json:"compression_ratio"`
+	Fallback         int     `json:"fallback"`
+	NoSpeechProb     float64 `json:"no_speech_prob"`
+	LowConfidence    bool    `json:"low_confidence"`
+	SourceText       string  `json:"source_text,omitempty"`
+}
+
+// Write writes the transcript in the format
+func Write(w io.Writer, f Format, t *Transcript, opts WriteOptions) error {
+	formatter, ok := formatters[f]
+	if !ok {
+		return fmt.Errorf("unsupported format %q", f)
+	}
+	return formatter.Write(w, t, opts)
+}
+
+func writeJSON(w io.Writer, t *Transcript, _ WriteOptions) error {
+	return json.NewEncoder(w).Encode(Response{Text: t.Text()})
+}
+
+func writeVerboseJSON(w io.Writer, t *Transcript, _ WriteOptions) error {
+	return json.NewEncoder(w).Encode(t.Verbose())
+}
+
+func writeText(w io.Writer, t *Transcript, _ WriteOptions) error {
+	_, err := io.WriteString(w, t.Text()+"\n")
+	return err
+}
+
+// Verbose converts the transcript to the body of the verbose_json format
+func (t *Transcript) Verbose() VerboseResponse {
+	task := t.Task
+	if task == "" {
+		task = "transcribe"
+	}
+
+	response := VerboseResponse{
+		Task:                task,
+		Language:            t.Language,
+		LanguageProbability: t.LanguageProbability,
+		SourceLanguage:      t.SourceLanguage,
+		Duration:            t.Duration.Seconds(),
+		Text:                t.Text(),
+		Segments:            make([]VerboseSegment, len(t.Segments)),
+	}
+
+	for i, seg := range t.Segments {
+		tokens := seg.TextTokens()
+		ids := make([]int32, len(tokens))
+		for j, token := range tokens {
+			ids[j] = token.ID
+		}
+
+		response.Segments[i] = VerboseSegment{
+			ID:               seg.ID,
+			Start:            seg.Start.Seconds(),
+			End:              seg.End.Seconds(),
+			Text:             seg.Text,
+			Tokens:           ids,
+			AvgLogprob:       seg.AvgLogprob(),
+			CompressionRatio: seg.CompressionRatio(),
+			Fallback:         seg.Fallback,
+			NoSpeechProb:     seg.NoSpeechProb(),
+			LowConfidence:    seg.LowConfidence,
+			SourceText:       seg.SourceText,
+		}
+	}
+
+	return response
+}
+
+func writeSRT(w io.Writer, t *Transcript, opts WriteOptions) error {
+	cues := t.Cues(opts.Subtitles)
+	var b strings.Builder
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n", i+1,
+			formatTimestamp(cue.Start, ","), formatTimestamp(cue.End, ","), cue.Text())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeVTT(w io.Writer, t *Transcript, opts WriteOptions) error {
+	cues := t.Cues(opts.Subtitles)
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for _, cue := range cues {
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n",
+			formatTimestamp(cue.Start, "."), formatTimestamp(cue.End, "."), cue.Text())
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeASS(w io.Writer, t *Transcript, opts WriteOptions) error {
+	return writeSubStation(w, t.Cues(opts.Subtitles), false)
+}
+
+func writeSSA(w io.Writer, t *Transcript, opts WriteOptions) error {
+	return writeSubStation(w, t.Cues(opts.Subtitles), true)
+}
+
+// writeSubStation writes Advanced SubStation Alpha subtitles with a single
+// default style, or the older SubStation Alpha v4 when ssa is set
+func writeSubStation(w io.Writer, cues []Cue, ssa bool) error {
+	var b strings.Builder
+	b.WriteString("[Script Info]\n")
+	if ssa {
+		b.WriteString("ScriptType: v4.00\n")
+	} else {
+		b.WriteString("ScriptType: v4.00+\n")
+	}
+	b.WriteString("PlayResX: 384\nPlayResY: 288\n\n")
+
+	if ssa {
+		b.WriteString("[V4 Styles]\n")
+		b.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, TertiaryColour, BackColour, Bold, Italic, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, AlphaLevel, Encoding\n")
+		b.WriteString("Style: Default,Arial,16,16777215,255,0,0,0,0,1,1,0,2,10,10,10,0,1\n\n")
+		b.WriteString("[Events]\n")
+		b.WriteString("Format: Marked, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	} else {
+		b.WriteString("[V4+ Styles]\n")
+		b.WriteString("Format: Name, Fontname, Fontsize, PrimaryColour, SecondaryColour, OutlineColour, BackColour, Bold, Italic, Underline, StrikeOut, ScaleX, ScaleY, Spacing, Angle, BorderStyle, Outline, Shadow, Alignment, MarginL, MarginR, MarginV, Encoding\n")
+		b.WriteString("Style: Default,Arial,16,&H00FFFFFF,&H000000FF,&H00000000,&H80000000,0,0,0,0,100,100,0,0,1,1,0,2,10,10,10,1\n\n")
+		b.WriteString("[Events]\n")
+		b.WriteString("Format: Layer, Start, End, Style, Name, MarginL, MarginR, MarginV, Effect, Text\n")
+	}
+
+	// Braces start override codes, the text is shown as is
+	escape := strings.NewReplacer("{", "(", "}", ")", "\\", "/", "\n", " ")
+	for _, cue := range cues {
+		lines := make([]string, len(cue.Lines))
+		for i, line := range cue.Lines {
+			lines[i] = escape.Replace(line)
+		}
+		marked := "0"
+		if ssa {
+			marked = "Marked=0"
+		}
+		fmt.Fprintf(&b, "Dialogue: %s,%s,%s,Default,,0,0,0,,%s\n", marked,
+			formatASSTimestamp(cue.Start), formatASSTimestamp(cue.End), strings.Join(lines, `\N`))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeTTML writes Timed Text Markup Language subtitles
+func writeTTML(w io.Writer, t *Transcript, opts WriteOptions) error {
+	cues := t.Cues(opts.Subtitles)
+	language := t.Language
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	if language != "" {
+		fmt.Fprintf(&b, "<tt xmlns=\"http://www.w3.org/ns/ttml\" xml:lang=\"%s\">\n", language)
+	} else {
+		b.WriteString("<tt xmlns=\"http://www.w3.org/ns/ttml\">\n")
+	}
+	b.WriteString("  <body>\n    <div>\n")
+	for _, cue := range cues {
+		lines := make([]string, len(cue.Lines))
+		for i, line := range cue.Lines {
+			var escaped strings.Builder
+			if err := xml.EscapeText(&escaped, []byte(line)); err != nil {
+				return err
+			}
+			lines[i] = escaped.String()
+		}
+		fmt.Fprintf(&b, "      <p begin=\"%s\" end=\"%s\">%s</p>\n",
+			formatTimestamp(cue.Start, "."), formatTimestamp(cue.End, "."), strings.Join(lines, "<br/>"))
+	}
+	b.WriteString("    </div>\n  </body>\n</tt>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// formatASSTimestamp formats d as h:mm:ss.cc, the centiseconds of SubStation Alpha
+func formatASSTimestamp(d time.Duration) string {
+	cs := d.Milliseconds() / 10
+	return fmt.Sprintf("%d:%02d:%02d.%02d", cs/360000, cs/6000%60, cs/100%60, cs%100)
+}
+
+// formatTimestamp formats d as hh:mm:ss followed by the separator and milliseconds
+func formatTimestamp(d time.Duration, separator string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, separator, ms%1000)
+}
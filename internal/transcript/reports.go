@@ -0,0 +1,158 @@
+package transcript
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// writeJSONL writes one verbose_json segment per line
+func writeJSONL(w io.Writer, t *Transcript, _ WriteOptions) error {
+	encoder := json.NewEncoder(w)
+	for _, seg := range t.Verbose().Segments {
+		if err := encoder.Encode(seg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCSV writes one row per segment. The speaker column is empty, the engine
+// does not tell speakers apart, and the confidence is the average probability
+// of the tokens.
+func writeCSV(w io.Writer, t *Transcript, _ WriteOptions) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"start", "end", "speaker", "confidence", "text"}); err != nil {
+		return err
+	}
+	for _, seg := range t.Segments {
+		err := cw.Write([]string{
+			strconv.FormatFloat(seg.Start.Seconds(), 'f', 3, 64),
+			strconv.FormatFloat(seg.End.Seconds(), 'f', 3, 64),
+			"",
+			strconv.FormatFloat(seg.AvgProbability(), 'f', 3, 64),
+			strings.TrimSpace(seg.Text),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// paragraph is the text between two timestamps of a transcript document
+type paragraph struct {
+	start time.Duration
+	text  string
+
+	lowConfidence bool
+}
+
+// paragraphs groups the segments into paragraphs starting every interval, a
+// paragraph starts with the first segment after the interval elapsed
+func (t *Transcript) paragraphs(interval time.Duration) []paragraph {
+	var result []paragraph
+	var text strings.Builder
+	var next time.Duration
+	for _, seg := range t.Segments {
+		segText := strings.TrimSpace(seg.Text)
+		if segText == "" {
+			continue
+		}
+
+		if len(result) == 0 || (interval > 0 && seg.Start >= next) {
+			if n := len(result); n > 0 {
+				result[n-1].text = text.String()
+				text.Reset()
+			}
+			result = append(result, paragraph{start: seg.Start})
+			if interval > 0 {
+				next = (seg.Start/interval + 1) * interval
+			}
+		}
+
+		if text.Len() > 0 {
+			text.WriteByte(' ')
+		}
+		text.WriteString(segText)
+		if seg.LowConfidence {
+			result[len(result)-1].lowConfidence = true
+		}
+	}
+	if n := len(result); n > 0 {
+		result[n-1].text = text.String()
+	}
+	return result
+}
+
+// formatClock formats d as hh:mm:ss
+func formatClock(d time.Duration) string {
+	s := int64(d.Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// Characters with a meaning in Markdown, escaped in the transcript text
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`, ">", `\>`, "#", `\#`,
+)
+
+// writeMarkdown writes the transcript as paragraphs headed by their timestamp
+func writeMarkdown(w io.Writer, t *Transcript, opts WriteOptions) error {
+	var b strings.Builder
+	b.WriteString("# Transcript\n\n")
+	fmt.Fprintf(&b, "*Duration %s", formatClock(t.Duration))
+	if t.Language != "" {
+		fmt.Fprintf(&b, ", language %s", t.Language)
+	}
+	b.WriteString("*\n\n")
+
+	for _, p := range t.paragraphs(opts.TimestampInterval) {
+		fmt.Fprintf(&b, "**[%s]** %s\n\n", formatClock(p.start), markdownEscaper.Replace(p.text))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Styles of the HTML transcript, kept simple so word processors keep them
+// when the file is opened or pasted, e.g. to save it as DOCX
+const htmlStyle = `body { font-family: Calibri, Arial, sans-serif; font-size: 11pt; line-height: 1.5; max-width: 48em; margin: 2em auto; color: #222; }
+h1 { font-size: 18pt; margin-bottom: 0.2em; }
+p.meta { color: #666; margin-top: 0; }
+span.time { color: #1f5f99; font-weight: bold; margin-right: 0.5em; }
+p.low { background-color: #fff3cd; }`
+
+// writeHTML writes the transcript as a styled HTML document with a paragraph
+// per timestamp, paragraphs with low confidence segments are highlighted
+func writeHTML(w io.Writer, t *Transcript, opts WriteOptions) error {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n")
+	if t.Language != "" {
+		fmt.Fprintf(&b, "<html lang=\"%s\">\n", html.EscapeString(t.Language))
+	} else {
+		b.WriteString("<html>\n")
+	}
+	fmt.Fprintf(&b, "<head>\n<meta charset=\"utf-8\">\n<title>Transcript</title>\n<style>\n%s\n</style>\n</head>\n<body>\n", htmlStyle)
+	b.WriteString("<h1>Transcript</h1>\n")
+	fmt.Fprintf(&b, "<p class=\"meta\">Duration %s", formatClock(t.Duration))
+	if t.Language != "" {
+		fmt.Fprintf(&b, ", language %s", html.EscapeString(t.Language))
+	}
+	b.WriteString("</p>\n")
+
+	for _, p := range t.paragraphs(opts.TimestampInterval) {
+		class := ""
+		if p.lowConfidence {
+			class = ` class="low"`
+		}
+		fmt.Fprintf(&b, "<p%s><span class=\"time\">[%s]</span> %s</p>\n", class, formatClock(p.start), html.EscapeString(p.text))
+	}
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
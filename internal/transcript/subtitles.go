@@ -0,0 +1,278 @@
+package transcript
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SubtitleOptions shapes the cues of the subtitle formats
+type SubtitleOptions struct {
+	// Characters per line, longer cues are wrapped
+	MaxLineLength int
+
+	// Lines per cue, longer text is split into several cues
+	MaxLines int
+
+	// Cues are shown at least this long unless the next cue starts earlier
+	MinDuration time.Duration
+
+	// Cues are split before they get longer than this
+	MaxDuration time.Duration
+
+	// Reading speed in characters per second, faster cues are kept on screen
+	// longer when the next cue leaves room for it
+	MaxCPS float64
+}
+
+// DefaultSubtitleOptions returns the common broadcast guidelines: two lines of
+// 42 characters, shown for 1 to 7 seconds at up to 17 characters per second
+func DefaultSubtitleOptions() SubtitleOptions {
+	return SubtitleOptions{
+		MaxLineLength: 42,
+		MaxLines:      2,
+		MinDuration:   time.Second,
+		MaxDuration:   7 * time.Second,
+		MaxCPS:        17,
+	}
+}
+
+// Validate rejects options which cannot be satisfied
+func (o SubtitleOptions) Validate() error {
+	switch {
+	case o.MaxLineLength < 1:
+		return fmt.Errorf("invalid max_line_length %d", o.MaxLineLength)
+	case o.MaxLines < 1:
+		return fmt.Errorf("invalid max_lines %d", o.MaxLines)
+	case o.MinDuration < 0:
+		return fmt.Errorf("invalid min_duration %s", o.MinDuration)
+	case o.MaxDuration <= 0 || o.MaxDuration < o.MinDuration:
+		return fmt.Errorf("invalid max_duration %s, it must be positive and not shorter than min_duration", o.MaxDuration)
+	case o.MaxCPS <= 0 || math.IsNaN(o.MaxCPS) || math.IsInf(o.MaxCPS, 1):
+		return fmt.Errorf("invalid max_cps %g", o.MaxCPS)
+	}
+	return nil
+}
+
+// Pause in the speech which always ends a cue
+const cueGap = 1500 * time.Millisecond
+
+// Cue is a subtitle shown from Start to End
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	Lines []string
+}
+
+// Text returns the lines of the cue joined by newlines
+func (c Cue) Text() string {
+	return strings.Join(c.Lines, "\n")
+}
+
+// word is a timed word of the transcript
+type word struct {
+	text       string
+	space      bool // Preceded by a space, false within text without spaces, e.g. Chinese
+	start, end time.Duration
+}
+
+// Cues splits the transcript into subtitle cues. The words are timed by the
+// token timestamps, so a cue can start and end within a segment. Segments
+// without usable token timing, e.g. translated ones, spread their words over
+// the segment by their length.
+func (t *Transcript) Cues(opts SubtitleOptions) []Cue {
+	var words []word
+	for _, seg := range t.Segments {
+		words = append(words, segmentWords(seg, opts.MaxLineLength)...)
+	}
+
+	var cues []Cue
+	var current []word
+	flush := func() {
+		if len(current) > 0 {
+			cues = append(cues, Cue{
+				Start: current[0].start,
+				End:   current[len(current)-1].end,
+				Lines: wrapWords(current, opts.MaxLineLength, opts.MaxLines),
+			})
+			current = nil
+		}
+	}
+
+	for _, w := range words {
+		if len(current) > 0 {
+			last := current[len(current)-1]
+			if len(fillLines(append(current, w), opts.MaxLineLength)) > opts.MaxLines || w.end-current[0].start > opts.MaxDuration || w.start-last.end > cueGap {
+				flush()
+			}
+		}
+		current = append(current, w)
+
+		// A sentence ends the cue unless the cue would flash by
+		if endsSentence(w.text) && w.end-current[0].start >= opts.MinDuration {
+			flush()
+		}
+	}
+	flush()
+
+	fitReadingSpeed(cues, opts)
+	return cues
+}
+
+// segmentWords returns the timed words of a segment, words longer than a line
+// are split at token boundaries
+func segmentWords(seg Segment, maxLength int) []word {
+	tokens := seg.TextTokens()
+
+	var joined strings.Builder
+	for _, token := range tokens {
+		joined.WriteString(token.Text)
+	}
+	if seg.SourceText != "" || len(tokens) == 0 || strings.TrimSpace(joined.String()) != strings.TrimSpace(seg.Text) {
+		return spreadWords(seg)
+	}
+
+	var words []word
+	for _, token := range tokens {
+		text := token.Text
+		space := strings.HasPrefix(text, " ")
+		text = strings.TrimLeft(text, " ")
+		start := max(token.Start, seg.Start)
+		end := max(min(token.End, seg.End), start)
+
+		if n := len(words); n > 0 && !space && utf8.RuneCountInString(words[n-1].text+text) <= maxLength {
+			words[n-1].text += text
+			words[n-1].end = max(words[n-1].end, end)
+			continue
+		}
+		if text == "" {
+			continue
+		}
+		if n := len(words); n > 0 {
+			start = max(start, words[n-1].end)
+			end = max(end, start)
+		}
+		words = append(words, word{text: text, space: space || len(words) == 0, start: start, end: end})
+	}
+	return words
+}
+
+// spreadWords times the words of a segment by their share of its text
+func spreadWords(seg Segment) []word {
+	fields := strings.Fields(seg.Text)
+	total := 0
+	for _, f := range fields {
+		total += utf8.RuneCountInString(f)
+	}
+
+	words := make([]word, 0, len(fields))
+	duration := seg.End - seg.Start
+	offset := 0
+	for _, f := range fields {
+		n := utf8.RuneCountInString(f)
+		words = append(words, word{
+			text:  f,
+			space: true,
+			start: seg.Start + duration*time.Duration(offset)/time.Duration(total),
+			end:   seg.Start + duration*time.Duration(offset+n)/time.Duration(total),
+		})
+		offset += n
+	}
+	return words
+}
+
+// joinWords joins the words to a line
+func joinWords(words []word) string {
+	var b strings.Builder
+	for i, w := range words {
+		if i > 0 && w.space {
+			b.WriteByte(' ')
+		}
+		b.WriteString(w.text)
+	}
+	return b.String()
+}
+
+// wordsLength returns the number of characters of the joined words
+func wordsLength(words []word) int {
+	return utf8.RuneCountInString(joinWords(words))
+}
+
+// fillLines breaks the words into lines of at most width characters, filling
+// each line before starting the next, which needs the fewest lines. A word
+// longer than width gets a line of its own.
+func fillLines(words []word, width int) [][]word {
+	var lines [][]word
+	var line []word
+	for _, w := range words {
+		if len(line) > 0 && wordsLength(append(line, w)) > width {
+			lines = append(lines, line)
+			line = nil
+		}
+		line = append(line, w)
+	}
+	if len(line) > 0 {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// wrapWords breaks the words into lines of at most maxLength characters and
+// of similar length. Cues keeps the words within maxLines lines, words which
+// do not fit anyway are joined to the last line.
+func wrapWords(words []word, maxLength int, maxLines int) []string {
+	if len(words) == 0 {
+		return nil
+	}
+
+	lines := fillLines(words, maxLength)
+	if len(lines) > maxLines {
+		var last []word
+		for _, line := range lines[maxLines-1:] {
+			last = append(last, line...)
+		}
+		lines = append(lines[:maxLines-1], last)
+	}
+
+	// Narrow the lines as long as the words still fit as many lines, which
+	// balances their length
+	count := len(lines)
+	for width := (wordsLength(words) + count - 1) / count; width < maxLength; width++ {
+		if narrow := fillLines(words, width); len(narrow) <= count {
+			lines = narrow
+			break
+		}
+	}
+
+	result := make([]string, len(lines))
+	for i, line := range lines {
+		result[i] = joinWords(line)
+	}
+	return result
+}
+
+// endsSentence reports whether the word ends a sentence
+func endsSentence(text string) bool {
+	text = strings.TrimRight(text, `"')]»”`)
+	return strings.HasSuffix(text, ".") || strings.HasSuffix(text, "?") || strings.HasSuffix(text, "!") ||
+		strings.HasSuffix(text, "。") || strings.HasSuffix(text, "？") || strings.HasSuffix(text, "！")
+}
+
+// fitReadingSpeed extends the cues which are shown shorter than the minimum
+// duration or too short to read, as far as the next cue allows
+func fitReadingSpeed(cues []Cue, opts SubtitleOptions) {
+	for i := range cues {
+		cue := &cues[i]
+		chars := utf8.RuneCountInString(strings.Join(cue.Lines, " "))
+		reading := time.Duration(math.Ceil(float64(chars) / opts.MaxCPS * float64(time.Second)))
+		wanted := min(max(opts.MinDuration, reading), opts.MaxDuration)
+
+		end := max(cue.End, cue.Start+wanted)
+		if i < len(cues)-1 {
+			end = min(end, cues[i+1].Start)
+		}
+		cue.End = max(end, cue.End)
+	}
+}
@@ -0,0 +1,111 @@
+package transcript
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func textWords(text string) []word {
+	var words []word
+	for _, f := range strings.Fields(text) {
+		words = append(words, word{text: f, space: true})
+	}
+	return words
+}
+
+func TestWrapWords(t *testing.T) {
+	tests := []struct {
+		text      string
+		maxLength int
+		maxLines  int
+		want      []string
+	}{
+		{"aaaa bbbbbbbbb cc", 10, 3, []string{"aaaa", "bbbbbbbbb", "cc"}},
+		{"aaaa bbbbbbbbb", 10, 2, []string{"aaaa", "bbbbbbbbb"}},
+		{"one two three", 42, 2, []string{"one two three"}},
+		{"the quick brown fox jumps over the lazy dog", 30, 2, []string{"the quick brown fox", "jumps over the lazy dog"}},
+		{"aa bb cc dd ee ff", 9, 2, []string{"aa bb cc", "dd ee ff"}},
+		{"supercalifragilistic", 10, 2, []string{"supercalifragilistic"}},
+	}
+	for _, tt := range tests {
+		got := wrapWords(textWords(tt.text), tt.maxLength, tt.maxLines)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("wrapWords(%q, %d, %d) = %q, want %q", tt.text, tt.maxLength, tt.maxLines, got, tt.want)
+		}
+	}
+
+	if got := wrapWords(nil, 42, 2); got != nil {
+		t.Errorf("wrapWords(nil) = %q, want nil", got)
+	}
+}
+
+func TestCuesLineLength(t *testing.T) {
+	opts := DefaultSubtitleOptions()
+	opts.MaxLineLength = 10
+	opts.MaxDuration = time.Minute
+
+	tr := &Transcript{Segments: []Segment{
+		{Start: 0, End: 6 * time.Second, Text: " aaaa bbbbbbbbb cc dddddd e ffffffff gg hhh iiiiiiiii"},
+	}}
+
+	cues := tr.Cues(opts)
+	if len(cues) < 2 {
+		t.Fatalf("got %d cues, want the text split", len(cues))
+	}
+
+	var words []string
+	var end time.Duration
+	for _, cue := range cues {
+		if len(cue.Lines) > opts.MaxLines {
+			t.Errorf("cue %q has %d lines, max %d", cue.Lines, len(cue.Lines), opts.MaxLines)
+		}
+		for _, line := range cue.Lines {
+			if n := utf8.RuneCountInString(line); n > opts.MaxLineLength {
+				t.Errorf("line %q has %d characters, max %d", line, n, opts.MaxLineLength)
+			}
+			words = append(words, strings.Fields(line)...)
+		}
+		if cue.Start < end || cue.End <= cue.Start {
+			t.Errorf("cue %q from %s to %s overlaps or is empty", cue.Lines, cue.Start, cue.End)
+		}
+		end = cue.End
+	}
+
+	if got, want := strings.Join(words, " "), strings.TrimSpace(tr.Segments[0].Text); got != want {
+		t.Errorf("cues hold %q, want %q", got, want)
+	}
+}
+
+func TestCuesSentence(t *testing.T) {
+	tr := &Transcript{Segments: []Segment{
+		{Start: 0, End: 2 * time.Second, Text: " Hello there."},
+		{Start: 2 * time.Second, End: 4 * time.Second, Text: " How are you?"},
+	}}
+
+	var got [][]string
+	for _, cue := range tr.Cues(DefaultSubtitleOptions()) {
+		got = append(got, cue.Lines)
+	}
+	want := [][]string{{"Hello there."}, {"How are you?"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Cues() = %q, want %q", got, want)
+	}
+}
+
+func TestSubtitleOptionsValidate(t *testing.T) {
+	for _, cps := range []float64{0, -1, math.NaN(), math.Inf(1)} {
+		opts := DefaultSubtitleOptions()
+		opts.MaxCPS = cps
+		if opts.Validate() == nil {
+			t.Errorf("Validate() accepted max_cps %g", cps)
+		}
+	}
+
+	if err := DefaultSubtitleOptions().Validate(); err != nil {
+		t.Errorf("Validate() of the defaults = %v", err)
+	}
+}
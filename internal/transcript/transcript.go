@@ -0,0 +1,154 @@
+// Package transcript holds the result of a transcription independently of the
+// Whisper bindings and writes it in the supported response formats
+package transcript
+
+import (
+	"bytes"
+	"compress/zlib"
+	"math"
+	"strings"
+	"time"
+)
+
+// Transcript is the text of an audio file split into timed segments
+type Transcript struct {
+	// transcribe or translate
+	Task string
+
+	// ISO 639-1 code of the spoken language
+	Language string
+
+	// Relative score of the language among the detection candidates when it
+	// was detected, 1 when it was given
+	LanguageProbability float64
+
+	// ISO 639-1 code of the spoken language when the transcript was translated
+	// into Language
+	SourceLanguage string
+
+	// Duration of the audio
+	Duration time.Duration
+
+	Segments []Segment
+}
+
+// Segment is a part of the transcript with its start and end time
+type Segment struct {
+	ID     int
+	Start  time.Duration
+	End    time.Duration
+	Text   string
+	Tokens []Token
+
+	// Number of times the segment was decoded again because it failed the
+	// quality thresholds, 0 for the first decoding
+	Fallback int
+
+	// Set by FilterLowConfidence when the tokens have a low probability
+	LowConfidence bool
+
+	// Transcribed text of a translated segment, the tokens belong to this text
+	SourceText string
+}
+
+// Token is a piece of a segment as produced by the model
+type Token struct {
+	ID          int32
+	Text        string
+	Start       time.Duration
+	End         time.Duration
+	Probability float32
+
+	// Sum of the probabilities the model gave to the timestamp tokens, i.e. to
+	// ending the segment, when it produced the token
+	TimestampProbability float32
+
+	// Special tokens are timestamps and control tokens, not part of the text
+	Special bool
+}
+
+// Text joins the text of all segments
+func (t *Transcript) Text() string {
+	var b strings.Builder
+	for _, seg := range t.Segments {
+		b.WriteString(seg.Text)
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// TextTokens returns the tokens which are part of the text
+func (s *Segment) TextTokens() []Token {
+	tokens := make([]Token, 0, len(s.Tokens))
+	for _, token := range s.Tokens {
+		if !token.Special {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// AvgLogprob returns the average log probability of the text tokens, 0 when
+// the segment has none
+func (s *Segment) AvgLogprob() float64 {
+	tokens := s.TextTokens()
+	if len(tokens) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, token := range tokens {
+		// Clamp to avoid -Inf for tokens reported with a zero probability
+		sum += math.Log(math.Max(float64(token.Probability), 1e-10))
+	}
+	return sum / float64(len(tokens))
+}
+
+// AvgProbability returns the average probability of the text tokens, 0 when
+// the segment has none
+func (s *Segment) AvgProbability() float64 {
+	tokens := s.TextTokens()
+	if len(tokens) == 0 {
+		return 0
+	}
+
+	var sum float64
+	for _, token := range tokens {
+		sum += float64(token.Probability)
+	}
+	return sum / float64(len(tokens))
+}
+
+// NoSpeechProb estimates the probability that the segment is not speech. The
+// engine does not report the no-speech probability of Whisper, so this is the
+// average probability the model gave to ending the segment while it produced
+// the text: it hesitates on noise and silence. A segment without text is not
+// speech.
+func (s *Segment) NoSpeechProb() float64 {
+	tokens := s.TextTokens()
+	if len(tokens) == 0 {
+		return 1
+	}
+
+	var sum float64
+	for _, token := range tokens {
+		sum += math.Min(float64(token.TimestampProbability), 1)
+	}
+	return sum / float64(len(tokens))
+}
+
+// CompressionRatio returns the ratio of the text length to its zlib compressed
+// length. Repeated phrases compress well, a high ratio hints at a decoding
+// stuck in a loop.
+func (s *Segment) CompressionRatio() float64 {
+	text := []byte(strings.TrimSpace(s.Text))
+	if len(text) == 0 {
+		return 0
+	}
+
+	// Lower levels store short texts uncompressed
+	var b bytes.Buffer
+	w, _ := zlib.NewWriterLevel(&b, zlib.BestCompression)
+	w.Write(text)
+	w.Close()
+	return float64(len(text)) / float64(b.Len())
+}
@@ -0,0 +1,99 @@
+package translate
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Texts sent in a single request, long transcripts are translated in batches
+const batchSize = 100
+
+// LibreTranslate translates through the /translate endpoint of a
+// LibreTranslate compatible service, e.g. a local instance
+type LibreTranslate struct {
+	url    string
+	apiKey string
+	client *http.Client
+}
+
+// NewLibreTranslate returns a translator for the service at baseURL. The API
+// key may be empty for instances which do not require one.
+func NewLibreTranslate(baseURL string, apiKey string, timeout time.Duration) *LibreTranslate {
+	return &LibreTranslate{
+		url:    strings.TrimSuffix(baseURL, "/") + "/translate",
+		apiKey: apiKey,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+type libreRequest struct {
+	Q      []string `json:"q"`
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+	Format string   `json:"format"`
+	APIKey string   `json:"api_key,omitempty"`
+}
+
+type libreResponse struct {
+	TranslatedText []string `json:"translatedText"`
+	Error          string   `json:"error"`
+}
+
+// Translate sends the texts in batches of batchSize
+func (t *LibreTranslate) Translate(ctx context.Context, texts []string, source string, target string) ([]string, error) {
+	translations := make([]string, 0, len(texts))
+	for start := 0; start < len(texts); start += batchSize {
+		batch := texts[start:min(start+batchSize, len(texts))]
+		translated, err := t.translateBatch(ctx, batch, source, target)
+		if err != nil {
+			return nil, err
+		}
+		translations = append(translations, translated...)
+	}
+	return translations, nil
+}
+
+func (t *LibreTranslate) translateBatch(ctx context.Context, texts []string, source string, target string) ([]string, error) {
+	body, err := json.Marshal(libreRequest{Q: texts, Source: source, Target: target, Format: "text", APIKey: t.apiKey})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var result libreResponse
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("unexpected translation response with status %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != "" {
+			return nil, fmt.Errorf("translation failed with status %s: %s", resp.Status, result.Error)
+		}
+		return nil, fmt.Errorf("translation failed with status %s", resp.Status)
+	}
+	if len(result.TranslatedText) != len(texts) {
+		return nil, fmt.Errorf("the translation returned %d texts for %d", len(result.TranslatedText), len(texts))
+	}
+	return result.TranslatedText, nil
+}
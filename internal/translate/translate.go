@@ -0,0 +1,28 @@
+// Package translate translates transcripts into other languages through an
+// external translation service
+package translate
+
+import (
+	"context"
+	"fmt"
+)
+
+// Translator translates texts from the source language into the target
+// language, both given as ISO 639-1 codes
+type Translator interface {
+	// Translate returns one translation per text, in the order of the texts
+	Translate(ctx context.Context, texts []string, source string, target string) ([]string, error)
+}
+
+// Fake translates by prefixing each text with the target language, e.g.
+// "[es] Hello". It stands in for a translation service in tests.
+type Fake struct{}
+
+// Translate returns the prefixed texts
+func (Fake) Translate(_ context.Context, texts []string, _ string, target string) ([]string, error) {
+	translations := make([]string, len(texts))
+	for i, text := range texts {
+		translations[i] = fmt.Sprintf("[%s] %s", target, text)
+	}
+	return translations, nil
+}
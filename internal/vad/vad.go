@@ -0,0 +1,257 @@
+// Package vad finds the speech in decoded audio, so the silence between the
+// speech can be skipped instead of transcribed
+package vad
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+)
+
+// SampleRate of the PCM audio the detection works on, the rate of the decoded
+// audio Whisper takes
+const SampleRate = 16000
+
+// Mode selects whether the audio is transcribed as a whole or only its speech
+type Mode string
+
+const (
+	// ModeOff transcribes the whole audio
+	ModeOff Mode = "off"
+
+	// ModeOn transcribes only the speech regions
+	ModeOn Mode = "on"
+
+	// ModeRegions reports the speech regions without transcribing them
+	ModeRegions Mode = "regions"
+)
+
+// ParseMode converts a vad option value to a Mode, true and false are accepted
+// for on and off
+func ParseMode(value string) (Mode, error) {
+	switch value {
+	case "off", "false", "0":
+		return ModeOff, nil
+	case "on", "true", "1":
+		return ModeOn, nil
+	case "regions":
+		return ModeRegions, nil
+	}
+	return "", fmt.Errorf("unsupported vad %q, expected off, on or regions", value)
+}
+
+// Region is a part of the audio which contains speech
+type Region struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// Options tunes the detection
+type Options struct {
+	// A frame is speech when its energy is this many dB above the noise floor
+	Threshold float64
+
+	// Frames quieter than this level in dBFS are never speech
+	MinLevel float64
+
+	// Share of the frame energy which must lie in the voice band, it rejects
+	// rumble and hiss
+	VoiceRatio float64
+
+	// Speech shorter than this is dropped as a click or a cough
+	MinSpeech time.Duration
+
+	// Pauses shorter than this do not split a region
+	MinSilence time.Duration
+
+	// Added before and after each region, so the first and last syllables are
+	// not cut off
+	Padding time.Duration
+}
+
+// DefaultOptions returns options suited for speech recorded with background
+// noise, e.g. meetings and calls
+func DefaultOptions() Options {
+	return Options{
+		Threshold:  12,
+		MinLevel:   -60,
+		VoiceRatio: 0.5,
+		MinSpeech:  250 * time.Millisecond,
+		MinSilence: 800 * time.Millisecond,
+		Padding:    200 * time.Millisecond,
+	}
+}
+
+const (
+	// 30 ms frames, zero padded to the FFT size
+	frameSize = SampleRate * 30 / 1000
+	fftSize   = 512
+
+	// Voice band in Hz
+	voiceLow  = 100
+	voiceHigh = 4000
+
+	// Percentile of the frame energies taken as the noise floor
+	noisePercentile = 0.1
+)
+
+// frameDuration is the length of a frame
+const frameDuration = time.Duration(frameSize) * time.Second / SampleRate
+
+// Detect returns the speech regions of mono PCM samples at SampleRate
+func Detect(samples []float32, opts Options) []Region {
+	frames := len(samples) / frameSize
+	if frames == 0 {
+		return nil
+	}
+
+	levels := make([]float64, frames)
+	ratios := make([]float64, frames)
+	spectrum := newSpectrum()
+	for i := 0; i < frames; i++ {
+		frame := samples[i*frameSize : (i+1)*frameSize]
+		levels[i], ratios[i] = spectrum.analyze(frame)
+	}
+
+	threshold := max(noiseFloor(levels)+opts.Threshold, opts.MinLevel)
+
+	var regions []Region
+	for i := 0; i < frames; i++ {
+		if levels[i] < threshold || ratios[i] < opts.VoiceRatio {
+			continue
+		}
+
+		start := time.Duration(i) * frameDuration
+		end := start + frameDuration
+		if n := len(regions); n > 0 && start-regions[n-1].End < opts.MinSilence {
+			regions[n-1].End = end
+			continue
+		}
+		regions = append(regions, Region{Start: start, End: end})
+	}
+
+	total := time.Duration(len(samples)) * time.Second / SampleRate
+	result := make([]Region, 0, len(regions))
+	for _, region := range regions {
+		if region.End-region.Start < opts.MinSpeech {
+			continue
+		}
+
+		region.Start = max(region.Start-opts.Padding, 0)
+		region.End = min(region.End+opts.Padding, total)
+		if n := len(result); n > 0 && region.Start <= result[n-1].End {
+			result[n-1].End = region.End
+			continue
+		}
+		result = append(result, region)
+	}
+
+	return result
+}
+
+// SpeechDuration returns the total length of the regions
+func SpeechDuration(regions []Region) time.Duration {
+	var total time.Duration
+	for _, region := range regions {
+		total += region.End - region.Start
+	}
+	return total
+}
+
+// noiseFloor estimates the level of the background noise from the quietest frames
+func noiseFloor(levels []float64) float64 {
+	sorted := slices.Clone(levels)
+	slices.Sort(sorted)
+	return sorted[int(float64(len(sorted)-1)*noisePercentile)]
+}
+
+// spectrum holds the buffers and tables of the frame analysis
+type spectrum struct {
+	window   []float64
+	cos, sin []float64 // Twiddle factors of the FFT
+	re, im   []float64
+}
+
+func newSpectrum() *spectrum {
+	window := make([]float64, frameSize)
+	for i := range window {
+		window[i] = 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(frameSize-1))
+	}
+
+	cos := make([]float64, fftSize/2)
+	sin := make([]float64, fftSize/2)
+	for i := range cos {
+		cos[i] = math.Cos(-2 * math.Pi * float64(i) / fftSize)
+		sin[i] = math.Sin(-2 * math.Pi * float64(i) / fftSize)
+	}
+
+	return &spectrum{
+		window: window,
+		cos:    cos,
+		sin:    sin,
+		re:     make([]float64, fftSize),
+		im:     make([]float64, fftSize),
+	}
+}
+
+// analyze returns the level of the frame in dBFS and the share of its energy
+// in the voice band
+func (s *spectrum) analyze(frame []float32) (float64, float64) {
+	var energy float64
+	for i, sample := range frame {
+		energy += float64(sample) * float64(sample)
+		s.re[i] = float64(sample) * s.window[i]
+		s.im[i] = 0
+	}
+	for i := len(frame); i < fftSize; i++ {
+		s.re[i], s.im[i] = 0, 0
+	}
+	level := 10 * math.Log10(energy/float64(len(frame))+1e-12)
+
+	s.fft()
+
+	var total, voice float64
+	for bin := 1; bin <= fftSize/2; bin++ {
+		power := s.re[bin]*s.re[bin] + s.im[bin]*s.im[bin]
+		total += power
+		if hz := bin * SampleRate / fftSize; hz >= voiceLow && hz <= voiceHigh {
+			voice += power
+		}
+	}
+	if total == 0 {
+		return level, 0
+	}
+	return level, voice / total
+}
+
+// fft transforms re and im in place
+func (s *spectrum) fft() {
+	re, im, n := s.re, s.im, fftSize
+
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			re[i], re[j] = re[j], re[i]
+			im[i], im[j] = im[j], im[i]
+		}
+	}
+
+	for size := 2; size <= n; size <<= 1 {
+		step := n / size
+		for start := 0; start < n; start += size {
+			for k := 0; k < size/2; k++ {
+				wr, wi := s.cos[k*step], s.sin[k*step]
+				a, b := start+k, start+k+size/2
+				tr := re[b]*wr - im[b]*wi
+				ti := re[b]*wi + im[b]*wr
+				re[b], im[b] = re[a]-tr, im[a]-ti
+				re[a], im[a] = re[a]+tr, im[a]+ti
+			}
+		}
+	}
+}
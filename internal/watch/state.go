@@ -0,0 +1,127 @@
+package watch
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Results of a processed file
+const (
+	statusDone   = "done"
+	statusFailed = "failed"
+)
+
+// entry records a processed file. A file is identified by its name, size and
+// modification time, so a new recording reusing a name is processed again.
+type entry struct {
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	Status    string    `json:"status"`
+	Processed time.Time `json:"processed"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// stateFile keeps the processed files across restarts, so a file whose move
+// to the done or failed folder did not complete is not transcribed again
+type stateFile struct {
+	path string
+
+	mutex   sync.Mutex
+	Entries map[string]entry `json:"entries"`
+}
+
+func loadState(path string) (*stateFile, error) {
+	state := &stateFile{path: path, Entries: make(map[string]entry)}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, err
+	}
+	if state.Entries == nil {
+		state.Entries = make(map[string]entry)
+	}
+	return state, nil
+}
+
+// lookup returns the entry of the file if it was processed in this version
+func (s *stateFile) lookup(name string, info os.FileInfo) (entry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e, ok := s.Entries[name]
+	if !ok || e.Size != info.Size() || !e.ModTime.Equal(info.ModTime()) {
+		return entry{}, false
+	}
+	return e, true
+}
+
+func (s *stateFile) record(name string, info os.FileInfo, status string, err error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	e := entry{
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		Status:    status,
+		Processed: time.Now(),
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	s.Entries[name] = e
+	return s.save()
+}
+
+// forget removes the entries of files which left the watched directory
+func (s *stateFile) forget(present map[string]bool) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	changed := false
+	for name := range s.Entries {
+		if !present[name] {
+			delete(s.Entries, name)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return s.save()
+}
+
+// save writes the state under a temporary name and renames it, so a crash
+// never leaves a truncated state file. The caller holds the mutex.
+func (s *stateFile) save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(s.path), ".watch-state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), s.path)
+}
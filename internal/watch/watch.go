@@ -0,0 +1,356 @@
+// Package watch transcribes the audio files dropped into a directory, e.g. a
+// network share the dictation devices upload their recordings to
+package watch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/xzeldon/whisper-api-server/internal/api"
+	"github.com/xzeldon/whisper-api-server/internal/batch"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"golang.org/x/sys/windows"
+)
+
+// Options configures the watched directory
+type Options struct {
+	// Directory polled for new recordings, subdirectories are ignored
+	Dir string
+
+	// Directory for the transcripts, default <Dir>/transcripts
+	OutputDir string
+
+	// Output formats, see batch.ParseFormats
+	Formats []string
+
+	// Originals are moved here once transcribed, default <Dir>/done. On
+	// another volume than Dir they are copied and removed.
+	DoneDir string
+
+	// Originals which could not be transcribed are moved here, default
+	// <Dir>/failed
+	FailedDir string
+
+	// Processed files are recorded here, default <Dir>/.whisper-watch.json
+	StateFile string
+
+	// Interval between two scans of the directory
+	Interval time.Duration
+
+	// A file is transcribed once its size and modification time did not
+	// change for this long, so recordings still being copied are left alone
+	Settle time.Duration
+}
+
+// pending is a file seen in the directory which is not processed yet
+type pending struct {
+	size    int64
+	modTime time.Time
+	since   time.Time
+	ignored bool
+}
+
+type watcher struct {
+	engine  *api.WhisperState
+	opts    Options
+	formats []transcript.Format
+	state   *stateFile
+
+	pending  map[string]*pending
+	mutex    sync.Mutex
+	inflight map[string]bool
+}
+
+// Run polls the directory until ctx is cancelled. As many files as the engine
+// has contexts are transcribed in parallel. Cancelling ctx aborts the running
+// transcriptions, their files are left in place and processed after a restart.
+func Run(ctx context.Context, engine *api.WhisperState, opts Options) error {
+	opts.setDefaults()
+
+	formats, err := batch.ParseFormats(opts.Formats)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{opts.OutputDir, opts.DoneDir, opts.FailedDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+
+	state, err := loadState(opts.StateFile)
+	if err != nil {
+		return fmt.Errorf("loading state file %s: %w", opts.StateFile, err)
+	}
+
+	w := &watcher{
+		engine:   engine,
+		opts:     opts,
+		formats:  formats,
+		state:    state,
+		pending:  make(map[string]*pending),
+		inflight: make(map[string]bool),
+	}
+
+	stop := context.AfterFunc(ctx, engine.Cancel)
+	defer stop()
+
+	names := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < engine.Workers(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				w.process(ctx, name)
+			}
+		}()
+	}
+
+	slog.Info("Watching directory", "dir", opts.Dir, "output", opts.OutputDir, "interval", opts.Interval)
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+loop:
+	for {
+		for _, name := range w.scan() {
+			select {
+			case names <- name:
+			case <-ctx.Done():
+				w.finish(name)
+				break loop
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+
+	close(names)
+	wg.Wait()
+	return nil
+}
+
+func (opts *Options) setDefaults() {
+	if opts.OutputDir == "" {
+		opts.OutputDir = filepath.Join(opts.Dir, "transcripts")
+	}
+	if opts.DoneDir == "" {
+		opts.DoneDir = filepath.Join(opts.Dir, "done")
+	}
+	if opts.FailedDir == "" {
+		opts.FailedDir = filepath.Join(opts.Dir, "failed")
+	}
+	if opts.StateFile == "" {
+		opts.StateFile = filepath.Join(opts.Dir, ".whisper-watch.json")
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 5 * time.Second
+	}
+	if opts.Settle <= 0 {
+		opts.Settle = 10 * time.Second
+	}
+}
+
+// scan lists the directory and returns the files which stopped growing and
+// are ready to be transcribed
+func (w *watcher) scan() []string {
+	entries, err := os.ReadDir(w.opts.Dir)
+	if err != nil {
+		slog.Error("Error reading watched directory", "dir", w.opts.Dir, "error", err)
+		return nil
+	}
+
+	now := time.Now()
+	present := make(map[string]bool)
+	var ready []string
+
+	for _, dirEntry := range entries {
+		name := dirEntry.Name()
+		if !dirEntry.Type().IsRegular() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		present[name] = true
+
+		info, err := dirEntry.Info()
+		if err != nil {
+			continue
+		}
+
+		p, ok := w.pending[name]
+		if !ok || p.size != info.Size() || !p.modTime.Equal(info.ModTime()) {
+			w.pending[name] = &pending{size: info.Size(), modTime: info.ModTime(), since: now}
+			continue
+		}
+		if p.ignored || now.Sub(p.since) < w.opts.Settle || w.isInflight(name) {
+			continue
+		}
+
+		path := filepath.Join(w.opts.Dir, name)
+
+		// Processed before a restart, only the move is missing
+		if e, ok := w.state.lookup(name, info); ok {
+			w.move(path, e.Status)
+			continue
+		}
+
+		if audio, err := api.IsAudioFile(path); err != nil || !audio {
+			slog.Debug("Ignoring file which is not audio", "file", path)
+			p.ignored = true
+			continue
+		}
+
+		w.start(name)
+		ready = append(ready, name)
+	}
+
+	for name := range w.pending {
+		if !present[name] {
+			delete(w.pending, name)
+		}
+	}
+	if err := w.state.forget(present); err != nil {
+		slog.Error("Error saving watch state", "file", w.opts.StateFile, "error", err)
+	}
+
+	return ready
+}
+
+func (w *watcher) start(name string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.inflight[name] = true
+}
+
+func (w *watcher) finish(name string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.inflight, name)
+}
+
+func (w *watcher) isInflight(name string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.inflight[name]
+}
+
+// process transcribes a file, writes the transcripts and moves the original
+func (w *watcher) process(ctx context.Context, name string) {
+	defer w.finish(name)
+
+	path := filepath.Join(w.opts.Dir, name)
+	logger := slog.Default().With("file", path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		logger.Error("Error reading file", "error", err)
+		return
+	}
+
+	logger.Info("Transcribing file")
+	result, err := w.engine.TranscribeFile(ctx, logger, path, api.TranscribeOptions{})
+	if err == nil {
+		err = batch.WriteOutputs(result, path, w.opts.OutputDir, w.formats)
+	}
+
+	// Interrupted by a shutdown, the file is processed again after a restart
+	if ctx.Err() != nil {
+		return
+	}
+
+	status := statusDone
+	if err != nil {
+		logger.Error("Error transcribing file", "error", err)
+		status = statusFailed
+	} else {
+		logger.Info("File transcribed", "duration", result.Duration)
+	}
+
+	if err := w.state.record(name, info, status, err); err != nil {
+		logger.Error("Error saving watch state", "error", err)
+	}
+	w.move(path, status)
+}
+
+// move moves the original to the done or failed directory. A file with the
+// same name already there is kept, the new one gets a timestamp suffix.
+func (w *watcher) move(path string, status string) {
+	dir := w.opts.DoneDir
+	if status == statusFailed {
+		dir = w.opts.FailedDir
+	}
+
+	target := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(target); err == nil {
+		ext := filepath.Ext(target)
+		target = strings.TrimSuffix(target, ext) + time.Now().Format("-20060102-150405") + ext
+	}
+
+	if err := moveFile(path, target); err != nil {
+		slog.Error("Error moving file", "file", path, "target", target, "error", err)
+	}
+}
+
+// moveFile renames the file, or copies and removes it when the target is on
+// another volume
+func moveFile(path string, target string) error {
+	err := os.Rename(path, target)
+	if errors.Is(err, windows.ERROR_NOT_SAME_DEVICE) || errors.Is(err, syscall.EXDEV) {
+		return copyAndRemove(path, target)
+	}
+	return err
+}
+
+// copyAndRemove copies the file under a temporary name next to the target,
+// renames it and removes the original. An interrupted copy never leaves a
+// truncated file under the target name, and the original stays in place.
+func copyAndRemove(path string, target string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	partPath := target + ".part"
+	dst, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer os.Remove(partPath)
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	if err := os.Chtimes(partPath, info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, target); err != nil {
+		return err
+	}
+
+	// Close before removing, Windows does not remove an open file
+	src.Close()
+	return os.Remove(path)
+}
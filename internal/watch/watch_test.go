@@ -0,0 +1,60 @@
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCopyAndRemove(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recording.wav")
+	target := filepath.Join(dir, "done", "recording.wav")
+	if err := os.Mkdir(filepath.Dir(target), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.WriteFile(path, []byte("RIFF audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyAndRemove(path, target); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("original was not removed: %v", err)
+	}
+	if _, err := os.Stat(target + ".part"); !os.IsNotExist(err) {
+		t.Errorf("temporary copy was left behind: %v", err)
+	}
+	data, err := os.ReadFile(target)
+	if err != nil || string(data) != "RIFF audio" {
+		t.Errorf("target %q, %v, want the original content", data, err)
+	}
+	if info, err := os.Stat(target); err != nil {
+		t.Error(err)
+	} else if !info.ModTime().Equal(modTime) {
+		t.Errorf("target modification time %v, want %v", info.ModTime(), modTime)
+	}
+}
+
+func TestCopyAndRemoveMissingDir(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "recording.wav")
+	if err := os.WriteFile(path, []byte("RIFF audio"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyAndRemove(path, filepath.Join(dir, "missing", "recording.wav")); err == nil {
+		t.Fatal("copy into a missing directory succeeded")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("original was removed after a failed copy: %v", err)
+	}
+}
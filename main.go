@@ -1,71 +1,256 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/xzeldon/whisper-api-server/internal/api"
+	"github.com/xzeldon/whisper-api-server/internal/batch"
+	"github.com/xzeldon/whisper-api-server/internal/logging"
+	"github.com/xzeldon/whisper-api-server/internal/metrics"
 	"github.com/xzeldon/whisper-api-server/internal/resources"
+	"github.com/xzeldon/whisper-api-server/internal/transcript"
+	"github.com/xzeldon/whisper-api-server/internal/translate"
+	"github.com/xzeldon/whisper-api-server/internal/vad"
+	"github.com/xzeldon/whisper-api-server/internal/watch"
 )
 
-const (
-	defaultModelType      = "ggml-medium.bin"
-	defaultWhisperVersion = "1.12.0"
-)
-
-func changeWorkingDirectory(e *echo.Echo) {
+func changeWorkingDirectory() {
 	exePath, err := os.Executable()
 	if err != nil {
-		e.Logger.Error("Error getting executable path: ", err)
+		slog.Error("Error getting executable path", "error", err)
 		return
 	}
 
 	exeDir := filepath.Dir(exePath)
 	if err := os.Chdir(exeDir); err != nil {
-		e.Logger.Error("Error changing working directory: ", err)
+		slog.Error("Error changing working directory", "error", err)
 		return
 	}
+}
 
-	cwd, _ := os.Getwd()
-	fmt.Println("Current working directory:", cwd)
+// setupLogger installs the configured logger as the default one, which is also
+// used by echo and by the native library
+func setupLogger(e *echo.Echo, format string, level string) error {
+	logger, err := logging.New(os.Stderr, format, level)
+	if err != nil {
+		return err
+	}
+
+	slog.SetDefault(logger)
+	e.StdLogger = slog.NewLogLogger(logger.Handler(), slog.LevelError)
+	e.Server.ErrorLog = e.StdLogger
+	e.TLSServer.ErrorLog = e.StdLogger
+	return nil
 }
 
 func main() {
 	e := echo.New()
 	e.HideBanner = true
-	changeWorkingDirectory(e)
+	e.HTTPErrorHandler = api.ErrorHandler
+	changeWorkingDirectory()
 
 	args, err := resources.ParseFlags()
 	if err != nil {
-		e.Logger.Error("Error parsing flags: ", err)
+		slog.Error("Error parsing flags", "error", err)
 		return
 	}
+	if args.Done {
+		return
+	}
+
+	if err := setupLogger(e, args.LogFormat, args.LogLevel); err != nil {
+		slog.Error("Error configuring the logger", "error", err)
+		return
+	}
+
+	cwd, _ := os.Getwd()
+	slog.Debug("Current working directory", "path", cwd)
 
-	if _, err := resources.HandleWhisperDll(defaultWhisperVersion); err != nil {
-		e.Logger.Error("Error handling Whisper.dll: ", err)
+	dllPath, err := resources.HandleWhisperDll(args.WhisperVersion, args.Sources, args.Download)
+	if err != nil {
+		slog.Error("Error handling Whisper.dll", "error", err)
 		return
 	}
 
-	if _, err := resources.HandleDefaultModel(defaultModelType); err != nil {
-		e.Logger.Error("Error handling model file: ", err)
+	if _, err := resources.HandleModel(args.ModelPath, resources.DefaultModelType, args.Sources, args.Download); err != nil {
+		slog.Error("Error handling model file", "error", err)
 		return
 	}
 
+	e.Use(logging.Middleware())
+	e.Use(metrics.Middleware())
 	e.Use(middleware.CORS())
 
-	whisperState, err := api.InitializeWhisperState(args.ModelPath, args.Language)
+	var translator translate.Translator
+	if args.TranslateURL != "" {
+		translator = translate.NewLibreTranslate(args.TranslateURL, args.TranslateAPIKey, time.Duration(args.TranslateTimeout)*time.Second)
+	}
+
+	whisperState, err := api.InitializeWhisperState(api.Options{
+		DllPath:          dllPath,
+		ModelPath:        args.ModelPath,
+		Language:         args.Language,
+		LogLevel:         args.LogLevel,
+		SamplingStrategy: args.SamplingStrategy,
+		GPU:              args.GPU,
+		TmpDir:           args.TmpDir,
+		Contexts:         args.Contexts,
+
+		DetectLanguages: args.DetectLanguages,
+
+		Glossaries:        args.Glossaries,
+		DefaultGlossaries: api.ParseList(args.Glossary),
+
+		Fallback: api.FallbackOptions{
+			Enabled:                   args.Fallback,
+			CompressionRatioThreshold: args.CompressionRatioThreshold,
+			LogprobThreshold:          args.LogprobThreshold,
+		},
+
+		Translator: translator,
+
+		Filters: api.ParseList(args.Filters),
+		FilterOptions: transcript.FilterOptions{
+			NoSpeechThreshold:      args.NoSpeechThreshold,
+			LowConfidenceThreshold: args.LowConfidenceThreshold,
+			Hallucinations:         args.Hallucinations,
+		},
+
+		VAD: vad.Mode(args.VAD),
+
+		ChunkLength:  time.Duration(args.ChunkLength) * time.Second,
+		ChunkOverlap: time.Duration(args.ChunkOverlap) * time.Second,
+
+		TmpRetention:      time.Duration(args.TmpRetention) * time.Second,
+		MemoryDecodeLimit: int64(args.MemoryDecodeLimit),
+		MaxUploadSize:     int64(args.MaxUploadSize),
+		MaxAudioDuration:  time.Duration(args.MaxAudioDuration) * time.Second,
+	})
 	if err != nil {
-		e.Logger.Error("Error initializing Whisper state: ", err)
+		slog.Error("Error initializing Whisper state", "error", err)
 		return
 	}
 
-	e.POST("/v1/audio/transcriptions", func(c echo.Context) error {
-		return api.TranscribeFromFile(c, whisperState)
+	switch args.Command {
+	case resources.CommandTranscribe:
+		os.Exit(transcribeFiles(args, whisperState))
+	case resources.CommandWatch:
+		os.Exit(watchDirectory(args, whisperState))
+	}
+
+	api.Routes(e, whisperState)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- api.Start(e, api.ListenOptions{
+			Host:          args.Host,
+			Port:          args.Port,
+			Socket:        args.Socket,
+			TLSCert:       args.TLSCert,
+			TLSKey:        args.TLSKey,
+			TLSSelfSigned: args.TLSSelfSigned,
+		})
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error starting server", "error", err)
+		}
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+	}
+
+	shutdown(e, whisperState, time.Duration(args.ShutdownTimeout)*time.Second)
+}
+
+// transcribeFiles runs the transcribe command and returns the exit code
+func transcribeFiles(args *resources.ParsedArguments, whisperState *api.WhisperState) int {
+	defer whisperState.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := batch.Run(ctx, whisperState, batch.Options{
+		Inputs:    args.Transcribe.Inputs,
+		OutputDir: args.Transcribe.OutputDir,
+		Formats:   args.Transcribe.Formats,
+		Force:     args.Transcribe.Force,
 	})
+	if err != nil {
+		slog.Error("Error transcribing files", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// watchDirectory runs the watch command until it is interrupted and returns the exit code
+func watchDirectory(args *resources.ParsedArguments, whisperState *api.WhisperState) int {
+	defer whisperState.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err := watch.Run(ctx, whisperState, watch.Options{
+		Dir:       args.Watch.Dir,
+		OutputDir: args.Watch.OutputDir,
+		Formats:   args.Watch.Formats,
+		DoneDir:   args.Watch.DoneDir,
+		FailedDir: args.Watch.FailedDir,
+		StateFile: args.Watch.StateFile,
+		Interval:  args.Watch.Interval,
+		Settle:    args.Watch.Settle,
+	})
+	if err != nil {
+		slog.Error("Error watching directory", "error", err)
+		return 1
+	}
+	return 0
+}
+
+// cancelTimeout is how long a shutdown waits for the cancelled transcriptions.
+// A transcription only stops before an encoder run, a native call which does
+// not get there in time is abandoned.
+const cancelTimeout = 10 * time.Second
+
+// shutdown stops accepting requests, waits up to the timeout for running
+// transcriptions, cancels the remaining ones and releases the Whisper objects
+func shutdown(e *echo.Echo, whisperState *api.WhisperState, timeout time.Duration) {
+	whisperState.Drain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := e.Shutdown(ctx); err != nil {
+		slog.Error("Error shutting down the server", "error", err)
+	}
+
+	if !whisperState.Wait(ctx) {
+		slog.Warn("Shutdown timeout reached, cancelling running transcriptions")
+		whisperState.Cancel()
+
+		ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+		defer cancel()
+		if !whisperState.Wait(ctx) {
+			// Close would wait for the workers of the stuck transcriptions
+			slog.Error("Cancelled transcriptions did not stop, exiting without releasing the Whisper objects", "timeout", cancelTimeout)
+			return
+		}
+	}
 
-	address := fmt.Sprintf("127.0.0.1:%d", args.Port)
-	e.Logger.Fatal(e.Start(address))
+	whisperState.Close()
+	slog.Info("Server stopped")
 }
@@ -1,6 +1,7 @@
 package whisper
 
 import (
+	"fmt"
 	"syscall"
 	"unsafe"
 )
@@ -16,6 +17,17 @@ const (
 	SsINVALIDARG
 )
 
+// ParseSamplingStrategy converts a strategy name (greedy or beamSearch) to eSamplingStrategy
+func ParseSamplingStrategy(name string) (eSamplingStrategy, error) {
+	switch name {
+	case "greedy":
+		return SsGreedy, nil
+	case "beamSearch":
+		return SsBeamSearch, nil
+	}
+	return SsINVALIDARG, fmt.Errorf("unknown sampling strategy %q", name)
+}
+
 type eFullParamsFlags uint32
 
 const (
@@ -40,6 +52,9 @@ const (
 
 type FullParams struct {
 	cStruct *_FullParams
+
+	// Keeps the prompt tokens referenced by cStruct alive
+	prompt []int32
 }
 
 func (this *FullParams) CpuThreads() int32 {
@@ -66,6 +81,17 @@ func (this *FullParams) SetMaxTextCTX(val int32) {
 	this.cStruct.n_max_text_ctx = val
 }
 
+// SetMaxTokens limits the number of tokens per segment, 0 for no limit
+func (this *FullParams) SetMaxTokens(val int32) {
+	if this == nil {
+		return
+	} else if this.cStruct == nil {
+		return
+	}
+
+	this.cStruct.max_tokens = val
+}
+
 func (this *FullParams) AddFlags(newflag eFullParamsFlags) {
 	if this == nil {
 		return
@@ -86,6 +112,30 @@ func (this *FullParams) RemoveFlags(newflag eFullParamsFlags) {
 	this.cStruct.Flags = this.cStruct.Flags ^ newflag
 }
 
+// HasFlags reports whether all the flags are set
+func (this *FullParams) HasFlags(flags eFullParamsFlags) bool {
+	if this == nil {
+		return false
+	} else if this.cStruct == nil {
+		return false
+	}
+
+	return this.cStruct.Flags&flags == flags
+}
+
+// SetWindow restricts the transcription to duration milliseconds of audio
+// starting at offset, 0 for both transcribes the whole audio
+func (this *FullParams) SetWindow(offset int32, duration int32) {
+	if this == nil {
+		return
+	} else if this.cStruct == nil {
+		return
+	}
+
+	this.cStruct.offset_ms = offset
+	this.cStruct.duration_ms = duration
+}
+
 func (this *FullParams) SetLanguage(language int32) {
 	if this == nil {
 		return
@@ -96,6 +146,34 @@ func (this *FullParams) SetLanguage(language int32) {
 	this.cStruct.Language = eLanguage(language)
 }
 
+// SetPrompt sets the tokens the transcription continues from, nil clears them
+func (this *FullParams) SetPrompt(tokens []int32) {
+	if this == nil {
+		return
+	} else if this.cStruct == nil {
+		return
+	}
+
+	this.prompt = tokens
+	if len(tokens) == 0 {
+		this.cStruct.prompt_tokens = 0
+		this.cStruct.prompt_n_tokens = 0
+		return
+	}
+
+	this.cStruct.prompt_tokens = uintptr(unsafe.Pointer(&tokens[0]))
+	this.cStruct.prompt_n_tokens = int32(len(tokens))
+}
+
+// Prompt returns the tokens set with SetPrompt
+func (this *FullParams) Prompt() []int32 {
+	if this == nil {
+		return nil
+	}
+
+	return this.prompt
+}
+
 /*using pfnNewSegment = HRESULT( __cdecl* )( iContext* ctx, uint32_t n_new, void* user_data ) noexcept;*/
 type NewSegmentCallback_Type func(context *IContext, n_new uint32, user_data unsafe.Pointer) EWhisperHWND
 
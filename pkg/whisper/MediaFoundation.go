@@ -2,7 +2,6 @@ package whisper
 
 import (
 	"errors"
-	"fmt"
 	"syscall"
 	"unsafe"
 
@@ -61,7 +60,7 @@ func (this *IMediaFoundation) LoadAudioFile(file string, stereo bool) (*iAudioBu
 		uintptr(unsafe.Pointer(&buffer)))
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("loadAudioFile failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("loadAudioFile failed", "error", syscall.Errno(ret).Error())
 		return nil, syscall.Errno(ret)
 	}
 
@@ -82,7 +81,7 @@ func (this *IMediaFoundation) OpenAudioFile(file string, stereo bool) (*iAudioRe
 		uintptr(unsafe.Pointer(&buffer)))
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("openAudioFile failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("openAudioFile failed", "error", syscall.Errno(ret).Error())
 		return nil, syscall.Errno(ret)
 	}
 
@@ -104,7 +103,7 @@ func (this *IMediaFoundation) LoadAudioFileData(inbuffer *[]byte, stereo bool) (
 		uintptr(unsafe.Pointer(&reader)))
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("LoadAudioFileData failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("LoadAudioFileData failed", "error", syscall.Errno(ret).Error())
 		return nil, syscall.Errno(ret)
 	}
 
@@ -113,6 +112,10 @@ func (this *IMediaFoundation) LoadAudioFileData(inbuffer *[]byte, stereo bool) (
 
 // ************************************************************
 
+// AudioBuffer is audio decoded to PCM samples, it can be transcribed by several
+// contexts at once
+type AudioBuffer = iAudioBuffer
+
 type iAudioBuffer struct {
 	lpVtbl *iAudioBufferVtbl
 }
@@ -157,6 +160,29 @@ func (this *iAudioBuffer) CountSamples() (uint32, error) {
 	return uint32(ret), nil
 }
 
+// PcmMono returns the mono samples at 16 kHz. The slice points into the
+// buffer and is only valid until the buffer is released.
+func (this *iAudioBuffer) PcmMono() ([]float32, error) {
+	count, err := this.CountSamples()
+	if err != nil {
+		return nil, err
+	}
+
+	ret, _, _ := syscall.SyscallN(
+		this.lpVtbl.getPcmMono,
+		uintptr(unsafe.Pointer(this)),
+	)
+
+	if ret == 0 {
+		return nil, errors.New("the audio buffer has no mono samples")
+	}
+	if count == 0 {
+		return nil, nil
+	}
+
+	return unsafe.Slice((*float32)(unsafe.Pointer(ret)), count), nil
+}
+
 // ************************************************************
 
 type iAudioReader struct {
@@ -200,7 +226,7 @@ func (this *iAudioReader) GetDuration() (uint64, error) {
 	)
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("LoadAudioFileData failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("LoadAudioFileData failed", "error", syscall.Errno(ret).Error())
 		return 0, syscall.Errno(ret)
 	}
 
@@ -77,7 +77,7 @@ func (this *Model) CreateContext() (*IContext, error) {
 		uintptr(unsafe.Pointer(&context)))
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("createContext failed: %w", err.Error())
+		logger().Error("createContext failed", "error", err.Error())
 	}
 
 	if windows.Handle(ret) != windows.S_OK {
@@ -96,6 +96,42 @@ func (this *Model) IsMultilingual() bool {
 	return bool(windows.Handle(ret) == windows.S_OK)
 }
 
+/*
+using pfnDecodedTokens = HRESULT( __stdcall* )( const int* arr, int length, void* pv ) noexcept;
+The callback copies the tokens into the []int32 passed as pv, it is created
+once because the number of callbacks a process can create is limited.
+*/
+var tokenizeCallback = syscall.NewCallback(func(arr *int32, length int32, pv unsafe.Pointer) uintptr {
+	tokens := (*[]int32)(pv)
+	if length > 0 {
+		*tokens = append((*tokens)[:0], unsafe.Slice(arr, length)...)
+	}
+	return uintptr(S_OK)
+})
+
+// Tokenize converts the text to the tokens of the model vocabulary
+func (this *Model) Tokenize(text string) ([]int32, error) {
+	cText, err := windows.BytePtrFromString(text)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokens []int32
+	ret, _, _ := syscall.SyscallN(
+		this.cStruct.lpVtbl.tokenize,
+		uintptr(unsafe.Pointer(this.cStruct)),
+		uintptr(unsafe.Pointer(cText)),
+		tokenizeCallback,
+		uintptr(unsafe.Pointer(&tokens)),
+	)
+
+	if windows.Handle(ret) != windows.S_OK {
+		return nil, errors.New("Model.Tokenize() failed : " + syscall.Errno(ret).Error())
+	}
+
+	return tokens, nil
+}
+
 func (this *Model) Clone() (*_IModel, error) {
 
 	if this.setup.isFlagSet(gmf_Cloneable) {
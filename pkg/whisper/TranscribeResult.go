@@ -3,7 +3,6 @@ package whisper
 import (
 	"C"
 	"errors"
-	"fmt"
 	"syscall"
 	"unsafe"
 
@@ -143,7 +142,7 @@ func (this *ITranscribeResult) GetSize() (*sTranscribeLength, error) {
 	)
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("iTranscribeResult.GetSize failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("iTranscribeResult.GetSize failed", "error", syscall.Errno(ret).Error())
 		return nil, errors.New(syscall.Errno(ret).Error())
 	}
 
@@ -2,7 +2,6 @@ package whisper
 
 import (
 	"errors"
-	"fmt"
 	"syscall"
 	"unsafe"
 
@@ -96,7 +95,7 @@ func (context *IContext) TimingsPrint() error {
 	)
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("RunFull failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("RunFull failed", "error", syscall.Errno(ret).Error())
 		return errors.New(syscall.Errno(ret).Error())
 	}
 
@@ -117,7 +116,7 @@ func (context *IContext) RunFull(params *FullParams, buffer *iAudioBuffer) error
 	)
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("RunFull failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("RunFull failed", "error", syscall.Errno(ret).Error())
 		return errors.New(syscall.Errno(ret).Error())
 	}
 
@@ -138,7 +137,7 @@ func (context *IContext) RunStreamed(params *FullParams, reader *iAudioReader) e
 	)
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("RunStreamed failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("RunStreamed failed", "error", syscall.Errno(ret).Error())
 		return errors.New(syscall.Errno(ret).Error())
 	}
 
@@ -198,7 +197,7 @@ func (context *IContext) FullDefaultParams(strategy eSamplingStrategy) (*FullPar
 	// unsafe.Pointer(0x4000)
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("FullDefaultParams failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("FullDefaultParams failed", "error", syscall.Errno(ret).Error())
 		return nil, syscall.Errno(ret)
 
 	}
@@ -228,7 +227,7 @@ func (context *IContext) GetModel() (*_IModel, error) {
 	)
 
 	if windows.Handle(ret) != windows.S_OK {
-		fmt.Printf("FullDefaultParams failed: %s\n", syscall.Errno(ret).Error())
+		logger().Error("FullDefaultParams failed", "error", syscall.Errno(ret).Error())
 		return nil, syscall.Errno(ret)
 	}
 
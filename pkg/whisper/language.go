@@ -4,6 +4,27 @@ package whisper
 
 type eLanguage int32
 
+// LanguageCode returns the ISO 639 code packed into a language value, e.g. "en"
+// for English, or an empty string for Auto
+func LanguageCode(language int32) string {
+	var code []byte
+	for language > 0 {
+		code = append(code, byte(language&0xFF))
+		language >>= 8
+	}
+	return string(code)
+}
+
+// LanguageFromCode packs an ISO 639 code into a language value, the inverse of
+// LanguageCode. It does not check that the model knows the language.
+func LanguageFromCode(code string) int32 {
+	var language int32
+	for i := len(code) - 1; i >= 0; i-- {
+		language = language<<8 | int32(code[i])
+	}
+	return language
+}
+
 const (
 	Auto eLanguage = -1 // "af"
 
@@ -0,0 +1,179 @@
+package whisper
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Language describes a language the multilingual models transcribe
+type Language struct {
+	// Packed value passed to the library, e.g. English
+	Value int32
+
+	// English name, e.g. "German"
+	Name string
+
+	// Name in the language itself, e.g. "Deutsch"
+	NativeName string
+
+	// Other codes accepted for the language, e.g. the current ISO 639-1 code
+	// of a language Whisper knows by a deprecated one
+	Aliases []string
+}
+
+// Code returns the ISO 639 code of the language
+func (l Language) Code() string {
+	return LanguageCode(l.Value)
+}
+
+// ISOCode returns the current ISO 639-1 code of a language value. It differs
+// from LanguageCode for the languages Whisper knows by a deprecated code, e.g.
+// "he" instead of "iw" for Hebrew.
+func ISOCode(language int32) string {
+	for _, l := range languages {
+		if l.Value == language && len(l.Aliases) > 0 {
+			return l.Aliases[0]
+		}
+	}
+	return LanguageCode(language)
+}
+
+// languages is the registry of the languages in the order of the eLanguage
+// constants. The codes are derived from the constants, so the two cannot drift.
+var languages = []Language{
+	{Value: Afrikaans, Name: "Afrikaans", NativeName: "Afrikaans"},
+	{Value: Albanian, Name: "Albanian", NativeName: "Shqip"},
+	{Value: Amharic, Name: "Amharic", NativeName: "አማርኛ"},
+	{Value: Arabic, Name: "Arabic", NativeName: "العربية"},
+	{Value: Armenian, Name: "Armenian", NativeName: "Հայերեն"},
+	{Value: Assamese, Name: "Assamese", NativeName: "অসমীয়া"},
+	{Value: Azerbaijani, Name: "Azerbaijani", NativeName: "Azərbaycan"},
+	{Value: Bashkir, Name: "Bashkir", NativeName: "Башҡорт"},
+	{Value: Basque, Name: "Basque", NativeName: "Euskara"},
+	{Value: Belarusian, Name: "Belarusian", NativeName: "Беларуская"},
+	{Value: Bengali, Name: "Bengali", NativeName: "বাংলা"},
+	{Value: Bosnian, Name: "Bosnian", NativeName: "Bosanski"},
+	{Value: Breton, Name: "Breton", NativeName: "Brezhoneg"},
+	{Value: Bulgarian, Name: "Bulgarian", NativeName: "Български"},
+	{Value: Catalan, Name: "Catalan", NativeName: "Català"},
+	{Value: Chinese, Name: "Chinese", NativeName: "中文"},
+	{Value: Croatian, Name: "Croatian", NativeName: "Hrvatski"},
+	{Value: Czech, Name: "Czech", NativeName: "Čeština"},
+	{Value: Danish, Name: "Danish", NativeName: "Dansk"},
+	{Value: Dutch, Name: "Dutch", NativeName: "Nederlands"},
+	{Value: English, Name: "English", NativeName: "English"},
+	{Value: Estonian, Name: "Estonian", NativeName: "Eesti"},
+	{Value: Faroese, Name: "Faroese", NativeName: "Føroyskt"},
+	{Value: Finnish, Name: "Finnish", NativeName: "Suomi"},
+	{Value: French, Name: "French", NativeName: "Français"},
+	{Value: Galician, Name: "Galician", NativeName: "Galego"},
+	{Value: Georgian, Name: "Georgian", NativeName: "ქართული"},
+	{Value: German, Name: "German", NativeName: "Deutsch"},
+	{Value: Greek, Name: "Greek", NativeName: "Ελληνικά"},
+	{Value: Gujarati, Name: "Gujarati", NativeName: "ગુજરાતી"},
+	{Value: HaitianCreole, Name: "Haitian Creole", NativeName: "Kreyòl ayisyen"},
+	{Value: Hausa, Name: "Hausa", NativeName: "Hausa"},
+	{Value: Hawaiian, Name: "Hawaiian", NativeName: "ʻŌlelo Hawaiʻi"},
+	{Value: Hebrew, Name: "Hebrew", NativeName: "עברית", Aliases: []string{"he"}},
+	{Value: Hindi, Name: "Hindi", NativeName: "हिन्दी"},
+	{Value: Hungarian, Name: "Hungarian", NativeName: "Magyar"},
+	{Value: Icelandic, Name: "Icelandic", NativeName: "Íslenska"},
+	{Value: Indonesian, Name: "Indonesian", NativeName: "Bahasa Indonesia"},
+	{Value: Italian, Name: "Italian", NativeName: "Italiano"},
+	{Value: Japanese, Name: "Japanese", NativeName: "日本語"},
+	{Value: Javanese, Name: "Javanese", NativeName: "Basa Jawa", Aliases: []string{"jv"}},
+	{Value: Kannada, Name: "Kannada", NativeName: "ಕನ್ನಡ"},
+	{Value: Kazakh, Name: "Kazakh", NativeName: "Қазақ"},
+	{Value: Khmer, Name: "Khmer", NativeName: "ខ្មែរ"},
+	{Value: Korean, Name: "Korean", NativeName: "한국어"},
+	{Value: Lao, Name: "Lao", NativeName: "ລາວ"},
+	{Value: Latin, Name: "Latin", NativeName: "Latina"},
+	{Value: Latvian, Name: "Latvian", NativeName: "Latviešu"},
+	{Value: Lingala, Name: "Lingala", NativeName: "Lingála"},
+	{Value: Lithuanian, Name: "Lithuanian", NativeName: "Lietuvių"},
+	{Value: Luxembourgish, Name: "Luxembourgish", NativeName: "Lëtzebuergesch"},
+	{Value: Macedonian, Name: "Macedonian", NativeName: "Македонски"},
+	{Value: Malagasy, Name: "Malagasy", NativeName: "Malagasy"},
+	{Value: Malay, Name: "Malay", NativeName: "Bahasa Melayu"},
+	{Value: Malayalam, Name: "Malayalam", NativeName: "മലയാളം"},
+	{Value: Maltese, Name: "Maltese", NativeName: "Malti"},
+	{Value: Maori, Name: "Maori", NativeName: "Te Reo Māori"},
+	{Value: Marathi, Name: "Marathi", NativeName: "मराठी"},
+	{Value: Mongolian, Name: "Mongolian", NativeName: "Монгол"},
+	{Value: Myanmar, Name: "Myanmar", NativeName: "မြန်မာ"},
+	{Value: Nepali, Name: "Nepali", NativeName: "नेपाली"},
+	{Value: Norwegian, Name: "Norwegian", NativeName: "Norsk"},
+	{Value: Nynorsk, Name: "Nynorsk", NativeName: "Nynorsk"},
+	{Value: Occitan, Name: "Occitan", NativeName: "Occitan"},
+	{Value: Pashto, Name: "Pashto", NativeName: "پښتو"},
+	{Value: Persian, Name: "Persian", NativeName: "فارسی"},
+	{Value: Polish, Name: "Polish", NativeName: "Polski"},
+	{Value: Portuguese, Name: "Portuguese", NativeName: "Português"},
+	{Value: Punjabi, Name: "Punjabi", NativeName: "ਪੰਜਾਬੀ"},
+	{Value: Romanian, Name: "Romanian", NativeName: "Română"},
+	{Value: Russian, Name: "Russian", NativeName: "Русский"},
+	{Value: Sanskrit, Name: "Sanskrit", NativeName: "संस्कृतम्"},
+	{Value: Serbian, Name: "Serbian", NativeName: "Српски"},
+	{Value: Shona, Name: "Shona", NativeName: "ChiShona"},
+	{Value: Sindhi, Name: "Sindhi", NativeName: "سنڌي"},
+	{Value: Sinhala, Name: "Sinhala", NativeName: "සිංහල"},
+	{Value: Slovak, Name: "Slovak", NativeName: "Slovenčina"},
+	{Value: Slovenian, Name: "Slovenian", NativeName: "Slovenščina"},
+	{Value: Somali, Name: "Somali", NativeName: "Soomaali"},
+	{Value: Spanish, Name: "Spanish", NativeName: "Español"},
+	{Value: Sundanese, Name: "Sundanese", NativeName: "Basa Sunda"},
+	{Value: Swahili, Name: "Swahili", NativeName: "Kiswahili"},
+	{Value: Swedish, Name: "Swedish", NativeName: "Svenska"},
+	{Value: Tagalog, Name: "Tagalog", NativeName: "Tagalog"},
+	{Value: Tajik, Name: "Tajik", NativeName: "Тоҷикӣ"},
+	{Value: Tamil, Name: "Tamil", NativeName: "தமிழ்"},
+	{Value: Tatar, Name: "Tatar", NativeName: "Татар"},
+	{Value: Telugu, Name: "Telugu", NativeName: "తెలుగు"},
+	{Value: Thai, Name: "Thai", NativeName: "ไทย"},
+	{Value: Tibetan, Name: "Tibetan", NativeName: "བོད་ཡིག"},
+	{Value: Turkish, Name: "Turkish", NativeName: "Türkçe"},
+	{Value: Turkmen, Name: "Turkmen", NativeName: "Türkmen"},
+	{Value: Ukrainian, Name: "Ukrainian", NativeName: "Українська"},
+	{Value: Urdu, Name: "Urdu", NativeName: "اردو"},
+	{Value: Uzbek, Name: "Uzbek", NativeName: "Oʻzbek"},
+	{Value: Vietnamese, Name: "Vietnamese", NativeName: "Tiếng Việt"},
+	{Value: Welsh, Name: "Welsh", NativeName: "Cymraeg"},
+	{Value: Yiddish, Name: "Yiddish", NativeName: "ייִדיש"},
+	{Value: Yoruba, Name: "Yoruba", NativeName: "Yorùbá"},
+}
+
+// Languages returns the languages of the registry ordered by their English name
+func Languages() []Language {
+	return append([]Language(nil), languages...)
+}
+
+// FindLanguage looks a language up by its code, one of its aliases, its
+// English name or its native name, ignoring case
+func FindLanguage(name string) (Language, bool) {
+	name = strings.TrimSpace(name)
+	for _, l := range languages {
+		if strings.EqualFold(name, l.Code()) || strings.EqualFold(name, l.Name) || strings.EqualFold(name, l.NativeName) {
+			return l, true
+		}
+		for _, alias := range l.Aliases {
+			if strings.EqualFold(name, alias) {
+				return l, true
+			}
+		}
+	}
+	return Language{}, false
+}
+
+// ParseLanguage converts a language code or name to the value passed to the
+// library. An empty name or "auto" returns Auto.
+func ParseLanguage(name string) (int32, error) {
+	if name = strings.TrimSpace(name); name == "" || strings.EqualFold(name, "auto") {
+		return int32(Auto), nil
+	}
+
+	l, ok := FindLanguage(name)
+	if !ok {
+		return 0, fmt.Errorf("unsupported language %q", name)
+	}
+	return l.Value, nil
+}
@@ -2,7 +2,10 @@ package whisper
 
 import (
 	"C"
+	ctx "context"
 	"fmt"
+	"log/slog"
+	"sync/atomic"
 )
 
 /*
@@ -19,6 +22,21 @@ const (
 	LlDebug             = 3
 )
 
+// ParseLogLevel converts a level name (error, warning, info or debug) to eLogLevel
+func ParseLogLevel(name string) (eLogLevel, error) {
+	switch name {
+	case "error":
+		return LlError, nil
+	case "warning":
+		return LlWarning, nil
+	case "info":
+		return LlInfo, nil
+	case "debug":
+		return LlDebug, nil
+	}
+	return LlError, fmt.Errorf("unknown log level %q", name)
+}
+
 type eLogFlags uint8
 
 const (
@@ -34,10 +52,59 @@ type sLoggerSetup struct {
 	flags   eLogFlags // eLoggerFlags
 }
 
+func (lvl eLogLevel) String() string {
+	switch lvl {
+	case LlError:
+		return "error"
+	case LlWarning:
+		return "warning"
+	case LlInfo:
+		return "info"
+	case LlDebug:
+		return "debug"
+	}
+	return fmt.Sprintf("level(%d)", uint8(lvl))
+}
+
+// slogLevel maps the native level to the slog level
+func (lvl eLogLevel) slogLevel() slog.Level {
+	switch lvl {
+	case LlError:
+		return slog.LevelError
+	case LlWarning:
+		return slog.LevelWarn
+	case LlInfo:
+		return slog.LevelInfo
+	}
+	return slog.LevelDebug
+}
+
+var sinkLogger atomic.Pointer[slog.Logger]
+
+// SetLogger sets the logger receiving the messages of the native library and
+// of these bindings. When it is nil, the default slog logger is used.
+func SetLogger(logger *slog.Logger) {
+	sinkLogger.Store(logger)
+}
+
+func logger() *slog.Logger {
+	if logger := sinkLogger.Load(); logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// LoggerSink returns the callback for New which routes the messages of the
+// native library to the logger set with SetLogger
+func LoggerSink() *any {
+	var sink any = fnLoggerSink
+	return &sink
+}
+
 func fnLoggerSink(context uintptr, lvl eLogLevel, message *C.char) uintptr {
 
 	strmessage := C.GoString(message)
-	fmt.Printf("%d - %s\n", lvl, strmessage)
+	logger().Log(ctx.Background(), lvl.slogLevel(), strmessage, "source", "whisper.dll", "native_level", lvl.String())
 
 	return 0
 }
@@ -56,6 +56,11 @@ type Libwhisper struct {
 var singleton_whisper *Libwhisper = nil
 
 func New(level eLogLevel, flags eLogFlags, cb *any) (*Libwhisper, error) {
+	return NewFromPath(DLLName, level, flags, cb)
+}
+
+// NewFromPath loads whisper.dll from the given path instead of the DLL search path
+func NewFromPath(path string, level eLogLevel, flags eLogFlags, cb *any) (*Libwhisper, error) {
 	if singleton_whisper != nil {
 		return singleton_whisper, nil
 	}
@@ -63,7 +68,7 @@ func New(level eLogLevel, flags eLogFlags, cb *any) (*Libwhisper, error) {
 	var err error
 	this := &Libwhisper{}
 
-	this.ver, err = GetFileVersion(DLLName)
+	this.ver, err = GetFileVersion(path)
 	if err != nil {
 		return nil, err
 	}
@@ -72,7 +77,7 @@ func New(level eLogLevel, flags eLogFlags, cb *any) (*Libwhisper, error) {
 		return nil, errors.New("This library requires whisper.dll version 1.9 or higher.") // or less than 1.11 for now .. because the API changed
 	}
 
-	this.dll = syscall.NewLazyDLL(DLLName) // Todo wrap this in a class, check file exists, handle errors ... you know, just a few things.. AKA Stop being lazy
+	this.dll = syscall.NewLazyDLL(path) // Todo wrap this in a class, check file exists, handle errors ... you know, just a few things.. AKA Stop being lazy
 
 	this.proc_setupLogger = this.dll.NewProc("setupLogger")
 	this.proc_loadModel = this.dll.NewProc("loadModel")
@@ -98,6 +103,11 @@ func (this *Libwhisper) Version() string {
 	return fmt.Sprintf("%d.%d.%d.%d.", this.ver.Major, this.ver.Minor, this.ver.Patch, this.ver.Build)
 }
 
+// WinVersion returns the file version of whisper.dll
+func (this *Libwhisper) WinVersion() WinVersion {
+	return this.ver
+}
+
 func (this *Libwhisper) SupportsMultiThread() bool {
 	return this.ver.Major >= 1 && this.ver.Minor >= 10
 }
@@ -111,7 +121,7 @@ func (this *Libwhisper) _setupLogger(level eLogLevel, flags eLogFlags, cb *any)
 	setup.flags = flags
 
 	if cb != nil {
-		setup.sink = syscall.NewCallback(cb)
+		setup.sink = syscall.NewCallback(*cb)
 	}
 
 	res, _, err := this.proc_setupLogger.Call(uintptr(unsafe.Pointer(&setup)))
@@ -149,7 +159,7 @@ func (this *Libwhisper) LoadModel(path string, aGPU ...string) (*Model, error) {
 	obj, _, _ := this.proc_loadModel.Call(uintptr(unsafe.Pointer(whisperpath)), uintptr(unsafe.Pointer(setup.AsCType())), uintptr(unsafe.Pointer(nil)), uintptr(unsafe.Pointer(&modelptr)))
 
 	if windows.Handle(obj) != windows.S_OK {
-		fmt.Printf("loadModel failed: %s\n", syscall.Errno(obj).Error())
+		logger().Error("loadModel failed", "error", syscall.Errno(obj).Error())
 		return nil, fmt.Errorf("loadModel failed: %s", syscall.Errno(obj))
 	}
 
@@ -176,7 +186,7 @@ func (this *Libwhisper) InitMediaFoundation() (*IMediaFoundation, error) {
 	obj, _, _ := this.proc_initMediaFoundation.Call(uintptr(unsafe.Pointer(&mediafoundation)))
 
 	if windows.Handle(obj) != windows.S_OK {
-		fmt.Printf("initMediaFoundation failed: %s\n", syscall.Errno(obj).Error())
+		logger().Error("initMediaFoundation failed", "error", syscall.Errno(obj).Error())
 		return nil, fmt.Errorf("initMediaFoundation failed: %s", syscall.Errno(obj))
 	}
 
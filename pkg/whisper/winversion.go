@@ -45,6 +45,10 @@ type WinVersion struct {
 	Build uint32
 }
 
+func (v WinVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d.%d", v.Major, v.Minor, v.Patch, v.Build)
+}
+
 // FileVersion concatenates FileVersionMS and FileVersionLS to a uint64 value.
 func (fi VS_FIXEDFILEINFO) FileVersion() uint64 {
 	return uint64(fi.FileVersionMS)<<32 | uint64(fi.FileVersionLS)
@@ -109,7 +113,7 @@ func VerQueryValueRoot(block []byte) (VS_FIXEDFILEINFO, error) {
 func GetFileVersion(path string) (WinVersion, error) {
 	var result WinVersion
 	size, err := GetFileVersionInfoSize(path)
-	fmt.Println(path)
+	logger().Debug("Reading file version", "path", path)
 	if err != nil || size <= 0 {
 		return result, errors.New("GetFileVersionInfoSize failed")
 	}